@@ -0,0 +1,166 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"strconv"
+	"strings"
+)
+
+const brokerImageName = "nats:2.9"
+const brokerAgentImageName = "natsio/prometheus-nats-exporter:0.10.1"
+const brokerListeningPort = 4222
+const brokerMonitoringPort = 8222
+const brokerAgentListeningPort = 7777
+
+const subscriptionEnvKey = "VECRO_SUBSCRIPTIONS"
+
+// UnmarshalJSON accepts either a plain service name, which is a synchronous
+// call, or a call object.
+func (c *Call) UnmarshalJSON(data []byte) error {
+	var name string
+	if err := json.Unmarshal(data, &name); err == nil {
+		*c = Call{Name: name}
+		return nil
+	}
+
+	type call Call
+	return json.Unmarshal(data, (*call)(c))
+}
+
+// MarshalJSON emits a plain service name for a synchronous call without mesh
+// timeout & retries.
+func (c Call) MarshalJSON() ([]byte, error) {
+	if !c.Async && c.Timeout == 0 && c.Retries == 0 {
+		return json.Marshal(c.Name)
+	}
+
+	type call Call
+	return json.Marshal(call(c))
+}
+
+// resolveBrokers sets the broker of every async call without one to the only
+// broker in the system.
+func resolveBrokers(def *SystemDefinition) error {
+	brokers := make([]string, 0)
+	for _, svc := range def.Services {
+		if svc.Type == "broker" {
+			brokers = append(brokers, svc.Name)
+		}
+	}
+
+	for _, svc := range def.Services {
+		for j, call := range svc.Calls {
+			if !call.Async || call.Broker != "" {
+				continue
+			}
+			if len(brokers) != 1 {
+				return fmt.Errorf("async call from %q to %q must specify one of %d brokers", svc.Name, call.Name, len(brokers))
+			}
+			svc.Calls[j].Broker = brokers[0]
+		}
+	}
+
+	return nil
+}
+
+// validateCalls checks calls to other systems are synchronous calls to systems
+// composed with def, and async calls go to services of def through its broker
+// services.
+func validateCalls(def SystemDefinition) error {
+	for _, svc := range def.Services {
+		for _, call := range svc.Calls {
+			system, callee := def.Name, call.Name
+			if strings.Contains(call.Name, systemSeparator) {
+				system, callee = splitCall(call.Name)
+			}
+			if system != def.Name {
+				if call.Async {
+					return fmt.Errorf("async call to %q crosses systems, which is not supported", call.Name)
+				}
+				if _, ok := def.namespaces[system]; !ok {
+					return fmt.Errorf("system %q is not composed with %q", system, def.Name)
+				}
+				continue
+			}
+			if !call.Async {
+				continue
+			}
+
+			if def.service(callee) == nil {
+				return fmt.Errorf("async call from %q to %q calls no service of %q", svc.Name, call.Name, def.Name)
+			}
+			if broker := def.service(call.Broker); broker == nil || broker.Type != "broker" {
+				return fmt.Errorf("async call from %q to %q goes through %q, which is not a broker service of %q", svc.Name, call.Name, call.Broker, def.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// queueURL returns the URL of the queue carrying async calls to callee, e.g.
+// nats://social-queue:4222/social.user-info
+func queueURL(systemName string, broker string, callee string) string {
+	return fmt.Sprintf("nats://%s-%s:%d/%s.%s", systemName, broker, brokerListeningPort, systemName, callee)
+}
+
+// assembleSubscriptions returns the queues svc consumes async calls from.
+func assembleSubscriptions(svc Service, def SystemDefinition) string {
+	urls := make([]string, 0)
+	seen := make(map[string]bool)
+	for _, caller := range def.Services {
+		for _, call := range caller.Calls {
+			if !call.Async || call.Name != svc.Name {
+				continue
+			}
+
+			url := queueURL(def.Name, call.Broker, svc.Name)
+			if !seen[url] {
+				seen[url] = true
+				urls = append(urls, url)
+			}
+		}
+	}
+
+	return strings.Join(urls, calleeSeparator)
+}
+
+func prepareBrokerContainers(svc Service) []apiv1.Container {
+	broker := apiv1.Container{
+		Name:  svc.Name + "-broker",
+		Image: svc.imageOr(brokerImageName),
+		Args: []string{
+			"--jetstream",
+			"--http_port",
+			strconv.Itoa(brokerMonitoringPort),
+		},
+		Ports: []apiv1.ContainerPort{
+			{
+				ContainerPort: int32(brokerListeningPort),
+				Protocol:      apiv1.ProtocolTCP,
+			},
+		},
+	}
+	svc.Resources.applyTo(&broker.Resources)
+
+	// The agent exports queue backlog & throughput metrics of broker
+	agent := apiv1.Container{
+		Name:  svc.Name + "-agent",
+		Image: brokerAgentImageName,
+		Args: []string{
+			"-varz",
+			"-jsz=all",
+			fmt.Sprintf("http://localhost:%d", brokerMonitoringPort),
+		},
+		Ports: []apiv1.ContainerPort{
+			{
+				ContainerPort: int32(brokerAgentListeningPort),
+				Protocol:      apiv1.ProtocolTCP,
+			},
+		},
+	}
+
+	return []apiv1.Container{broker, agent}
+}
@@ -0,0 +1,253 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+)
+
+const nodeNameField = "metadata.name"
+
+// podDemand is the resource requests of one pod replica to be scheduled.
+type podDemand struct {
+	system       string
+	service      string
+	cpu          int64 // Millicores
+	memory       int64 // Bytes
+	nodeSelector map[string]string
+	node         string // Name of the node pods are placed on, if any
+}
+
+// nodeSupply is the resources left on one schedulable node.
+type nodeSupply struct {
+	name   string
+	labels map[string]string
+	cpu    int64 // Millicores
+	memory int64 // Bytes
+	pods   int64
+}
+
+// CheckCapacity estimates whether systems fit into the allocatable resources
+// of schedulable nodes before anything is created, and prints which services
+// would have pods stay Pending. It is an estimate only: nodes tainted with
+// NoSchedule or NoExecute are skipped, as deployed pods tolerate no taint, and
+// requests of sidecars injected by a service mesh are not counted.
+func CheckCapacity(ctx context.Context, clientset kubernetes.Interface, defs []SystemDefinition) (bool, error) {
+	demands := make([]podDemand, 0)
+	for _, def := range defs {
+		defDemands, err := preparePodDemands(def)
+		if err != nil {
+			return false, err
+		}
+		demands = append(demands, defDemands...)
+	}
+	supplies, err := listNodeSupplies(ctx, clientset)
+	if err != nil {
+		return false, err
+	}
+
+	var totalCPU, totalMemory, freeCPU, freeMemory int64
+	for _, demand := range demands {
+		totalCPU += demand.cpu
+		totalMemory += demand.memory
+	}
+	for _, supply := range supplies {
+		freeCPU += supply.cpu
+		freeMemory += supply.memory
+	}
+	fmt.Printf("Checking capacity...\n")
+	fmt.Printf("- Requested: cpu %s, memory %s by %d pods.\n", formatCPU(totalCPU), formatMemory(totalMemory), len(demands))
+	fmt.Printf("- Available: cpu %s, memory %s on %d schedulable nodes.\n", formatCPU(freeCPU), formatMemory(freeMemory), len(supplies))
+
+	// Place largest pods first, on the first node they fit in
+	sort.SliceStable(demands, func(i, j int) bool {
+		return demands[i].cpu > demands[j].cpu
+	})
+	pending := make(map[string]int)
+	order := make([]string, 0)
+	for _, demand := range demands {
+		if place(demand, supplies) {
+			continue
+		}
+
+		key := fmt.Sprintf("%s/%s", demand.system, demand.service)
+		if pending[key] == 0 {
+			order = append(order, key)
+		}
+		pending[key]++
+	}
+
+	sort.Strings(order)
+	for _, key := range order {
+		fmt.Printf("- Service %q: %d pods would stay Pending.\n", key, pending[key])
+	}
+	if len(order) > 0 {
+		fmt.Printf("Systems do not fit into the cluster.\n")
+		return false, nil
+	}
+	fmt.Printf("Systems fit into the cluster.\n")
+
+	return true, nil
+}
+
+func place(demand podDemand, supplies []*nodeSupply) bool {
+	for _, supply := range supplies {
+		if (demand.node != "" && demand.node != supply.name) || !matchLabels(demand.nodeSelector, supply.labels) ||
+			supply.cpu < demand.cpu || supply.memory < demand.memory || supply.pods < 1 {
+			continue
+		}
+
+		supply.cpu -= demand.cpu
+		supply.memory -= demand.memory
+		supply.pods--
+		return true
+	}
+
+	return false
+}
+
+func matchLabels(selector map[string]string, labels map[string]string) bool {
+	for key, value := range selector {
+		if labels[key] != value {
+			return false
+		}
+	}
+
+	return true
+}
+
+func preparePodDemands(def SystemDefinition) ([]podDemand, error) {
+	if err := validateDefinition(&def); err != nil {
+		return nil, err
+	}
+
+	demands := make([]podDemand, 0)
+	appendDemands := func(svcName string, replicas *int32, template apiv1.PodTemplateSpec) {
+		cpu, memory := podRequests(template.Spec)
+		for i := int32(0); i < *replicas; i++ {
+			demands = append(demands, podDemand{
+				system:       def.Name,
+				service:      svcName,
+				cpu:          cpu,
+				memory:       memory,
+				nodeSelector: template.Spec.NodeSelector,
+				node:         affinityNode(template.Spec),
+			})
+		}
+	}
+
+	deployments, err := prepareDeployments(def)
+	if err != nil {
+		return nil, err
+	}
+	for _, deployment := range deployments {
+		appendDemands(deployment.Labels[benServiceName], deployment.Spec.Replicas, deployment.Spec.Template)
+	}
+	statefulSets, err := prepareStatefulSets(def)
+	if err != nil {
+		return nil, err
+	}
+	for _, statefulSet := range statefulSets {
+		appendDemands(statefulSet.Labels[benServiceName], statefulSet.Spec.Replicas, statefulSet.Spec.Template)
+	}
+
+	return demands, nil
+}
+
+// podRequests returns the effective requests of a pod, which is the larger of
+// the sum of its containers and the largest of its init containers.
+func podRequests(spec apiv1.PodSpec) (int64, int64) {
+	var cpu, memory int64
+	for _, container := range spec.Containers {
+		cpu += container.Resources.Requests.Cpu().MilliValue()
+		memory += container.Resources.Requests.Memory().Value()
+	}
+	for _, container := range spec.InitContainers {
+		if initCPU := container.Resources.Requests.Cpu().MilliValue(); initCPU > cpu {
+			cpu = initCPU
+		}
+		if initMemory := container.Resources.Requests.Memory().Value(); initMemory > memory {
+			memory = initMemory
+		}
+	}
+
+	return cpu, memory
+}
+
+// listNodeSupplies returns the allocatable resources of every schedulable node
+// minus requests of pods already running on it.
+func listNodeSupplies(ctx context.Context, clientset kubernetes.Interface) ([]*nodeSupply, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+	pods, err := clientset.CoreV1().Pods("").List(ctx, metav1.ListOptions{
+		FieldSelector: "status.phase!=Succeeded,status.phase!=Failed",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	supplies := make([]*nodeSupply, 0)
+	byName := make(map[string]*nodeSupply)
+	for _, node := range nodes.Items {
+		if !isSchedulable(node) {
+			continue
+		}
+
+		allocatable := node.Status.Allocatable
+		supply := &nodeSupply{
+			name:   node.Name,
+			labels: node.Labels,
+			cpu:    allocatable.Cpu().MilliValue(),
+			memory: allocatable.Memory().Value(),
+			pods:   allocatable.Pods().Value(),
+		}
+		supplies = append(supplies, supply)
+		byName[node.Name] = supply
+	}
+
+	for _, pod := range pods.Items {
+		supply, ok := byName[pod.Spec.NodeName]
+		if !ok {
+			continue
+		}
+
+		cpu, memory := podRequests(pod.Spec)
+		supply.cpu -= cpu
+		supply.memory -= memory
+		supply.pods--
+	}
+
+	return supplies, nil
+}
+
+func isSchedulable(node apiv1.Node) bool {
+	if node.Spec.Unschedulable {
+		return false
+	}
+	for _, taint := range node.Spec.Taints {
+		if taint.Effect == apiv1.TaintEffectNoSchedule || taint.Effect == apiv1.TaintEffectNoExecute {
+			return false
+		}
+	}
+	for _, condition := range node.Status.Conditions {
+		if condition.Type == apiv1.NodeReady {
+			return condition.Status == apiv1.ConditionTrue
+		}
+	}
+
+	return false
+}
+
+func formatCPU(milli int64) string {
+	return resource.NewMilliQuantity(milli, resource.DecimalSI).String()
+}
+
+func formatMemory(bytes int64) string {
+	return resource.NewQuantity(bytes, resource.BinarySI).String()
+}
@@ -0,0 +1,61 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestCheckCapacityPlacesPodsOnNodeByName(t *testing.T) {
+	// Node names of managed clusters often differ from their hostname labels
+	node := &apiv1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "worker-1",
+			Labels: map[string]string{"kubernetes.io/hostname": "ip-10-0-0-1"},
+		},
+		Status: apiv1.NodeStatus{
+			Allocatable: apiv1.ResourceList{
+				apiv1.ResourceCPU:    resource.MustParse("8"),
+				apiv1.ResourceMemory: resource.MustParse("16Gi"),
+				apiv1.ResourcePods:   resource.MustParse("110"),
+			},
+			Conditions: []apiv1.NodeCondition{{Type: apiv1.NodeReady, Status: apiv1.ConditionTrue}},
+		},
+	}
+	tests := []struct {
+		node string
+		fits bool
+	}{
+		{"", true},
+		{"worker-1", true},
+		{"ip-10-0-0-1", false},
+	}
+	for _, test := range tests {
+		t.Run(test.node, func(t *testing.T) {
+			def := loadTestDefinition(t, "simple")
+			def.Services[0].Node = test.node
+
+			fits, err := CheckCapacity(context.Background(), fake.NewSimpleClientset(node), []SystemDefinition{def})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if fits != test.fits {
+				t.Errorf("got fits %v, want %v", fits, test.fits)
+			}
+		})
+	}
+}
+
+func TestNodeAffinity(t *testing.T) {
+	spec := apiv1.PodSpec{Affinity: prepareNodeAffinity(Service{Node: "worker-1"})}
+	if got := affinityNode(spec); got != "worker-1" {
+		t.Errorf("got node %q, want worker-1", got)
+	}
+	if got := prepareNodeAffinity(Service{}); got != nil {
+		t.Errorf("got affinity %v of service without node, want none", got)
+	}
+}
@@ -0,0 +1,104 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+const systemSeparator = "/"
+
+// Compose makes systems deployable as one environment, in which services call
+// services of other systems by <system>/<service>, resolved to cluster FQDNs.
+func Compose(defs []SystemDefinition) ([]SystemDefinition, error) {
+	namespaces := make(map[string]string, len(defs))
+	for _, def := range defs {
+		if _, ok := namespaces[def.Name]; ok {
+			return nil, fmt.Errorf("system %q is defined more than once", def.Name)
+		}
+		namespaces[def.Name] = def.Namespace
+	}
+
+	composed := make([]SystemDefinition, len(defs))
+	for i, def := range defs {
+		def.namespaces = namespaces
+		for _, svc := range def.Services {
+			for _, call := range svc.Calls {
+				if !strings.Contains(call.Name, systemSeparator) {
+					continue
+				}
+
+				system, _ := splitCall(call.Name)
+				if _, ok := namespaces[system]; !ok {
+					return nil, fmt.Errorf("service %q of %q calls %q of unknown system", svc.Name, def.Name, call.Name)
+				}
+			}
+		}
+		composed[i] = def
+	}
+
+	return composed, nil
+}
+
+// splitCall splits a call to <system>/<service> into system and service names.
+func splitCall(name string) (string, string) {
+	parts := strings.SplitN(name, systemSeparator, 2)
+	return parts[0], parts[1]
+}
+
+func (def SystemDefinition) namespaceOf(system string) (string, error) {
+	if system == def.Name {
+		return def.Namespace, nil
+	}
+
+	namespace, ok := def.namespaces[system]
+	if !ok {
+		return "", fmt.Errorf("system %q is not composed with %q", system, def.Name)
+	}
+
+	return namespace, nil
+}
+
+func createNamespace(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition) error {
+	labels, annotations := prepareNamespaceMeta(def)
+	namespace := &apiv1.Namespace{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:        def.Namespace,
+			Labels:      labels,
+			Annotations: annotations,
+		},
+	}
+
+	namespaceClient := clientset.CoreV1().Namespaces()
+	_, err := namespaceClient.Create(ctx, namespace, metav1.CreateOptions{})
+	if errors.IsAlreadyExists(err) {
+		if len(labels) == 0 && len(annotations) == 0 {
+			return nil
+		}
+
+		// Enable sidecar injection of namespaces shared with other systems
+		patch, _ := json.Marshal(map[string]interface{}{
+			"metadata": map[string]interface{}{
+				"labels":      labels,
+				"annotations": annotations,
+			},
+		})
+		_, err = namespaceClient.Patch(ctx, def.Namespace, types.MergePatchType, patch, metav1.PatchOptions{})
+		if err != nil {
+			return &ResourceError{Kind: "namespace", Name: def.Namespace, Err: err}
+		}
+		fmt.Printf("Enabled %s in namespace %q.\n", def.Mesh, def.Namespace)
+		return nil
+	} else if err != nil {
+		return &ResourceError{Kind: "namespace", Name: def.Namespace, Err: err}
+	}
+	fmt.Printf("Created namespace %q.\n", def.Namespace)
+
+	return nil
+}
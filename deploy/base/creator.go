@@ -0,0 +1,181 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/util/flowcontrol"
+	"strings"
+	"sync"
+)
+
+const (
+	OnErrorRollback = "rollback" // Deletes every resource created so far
+	OnErrorKeep     = "keep"     // Keeps created resources, so that deploying again resumes
+)
+
+// CreateOptions configures how resources of a system are created.
+type CreateOptions struct {
+	QPS     float32 // Maximum number of create requests per second
+	Workers int     // Number of concurrent create requests
+	OnError string  // OnErrorRollback or OnErrorKeep
+
+	// Dynamic creates objects of custom resources, such as those of mesh
+	Dynamic dynamic.Interface
+}
+
+// ResourceError is the failure to create or delete one resource.
+type ResourceError struct {
+	Kind string
+	Name string
+	Err  error
+}
+
+func (e *ResourceError) Error() string {
+	return fmt.Sprintf("%s %q: %v", e.Kind, e.Name, e.Err)
+}
+
+func (e *ResourceError) Unwrap() error {
+	return e.Err
+}
+
+// CreateError collects every resource failed to be created for a system.
+type CreateError struct {
+	System     string
+	Errors     []*ResourceError
+	RolledBack bool
+}
+
+func (e *CreateError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("failed to create %d resources of %q: %s", len(e.Errors), e.System, strings.Join(messages, "; "))
+}
+
+// task creates one resource. Resources already existing are skipped, so that
+// a partially deployed system could be resumed.
+type task struct {
+	kind   string
+	name   string
+	create func(ctx context.Context) error
+	delete func(ctx context.Context) error
+}
+
+// creator runs tasks concurrently under a QPS limit, and keeps track of the
+// resources it created in order to roll them back.
+type creator struct {
+	limiter flowcontrol.RateLimiter
+	workers int
+	dynamic dynamic.Interface
+
+	mu      sync.Mutex
+	created []task
+	skipped int
+	errs    []*ResourceError
+}
+
+func newCreator(opts CreateOptions) *creator {
+	qps, workers := opts.QPS, opts.Workers
+	if qps <= 0 {
+		qps = 10
+	}
+	if workers <= 0 {
+		workers = 5
+	}
+
+	return &creator{
+		limiter: flowcontrol.NewTokenBucketRateLimiter(qps, workers),
+		workers: workers,
+		dynamic: opts.Dynamic,
+	}
+}
+
+// run runs tasks and waits for all of them to finish. Tasks not started yet
+// when ctx is done fail with the error of ctx.
+func (c *creator) run(ctx context.Context, tasks []task) {
+	queue := make(chan task)
+	var wg sync.WaitGroup
+	for i := 0; i < c.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for t := range queue {
+				if err := c.limiter.Wait(ctx); err != nil {
+					c.record(t, ctx.Err())
+					continue
+				}
+				c.record(t, t.create(ctx))
+			}
+		}()
+	}
+
+	for _, t := range tasks {
+		queue <- t
+	}
+	close(queue)
+	wg.Wait()
+}
+
+func (c *creator) record(t task, err error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	switch {
+	case errors.IsAlreadyExists(err):
+		fmt.Printf("- Skipped existing %s %q.\n", t.kind, t.name)
+		c.skipped++
+	case err != nil:
+		fmt.Printf("- Failed to create %s %q: %v\n", t.kind, t.name, err)
+		c.errs = append(c.errs, &ResourceError{Kind: t.kind, Name: t.name, Err: err})
+	default:
+		fmt.Printf("- Created %s %q.\n", t.kind, t.name)
+		c.created = append(c.created, t)
+	}
+}
+
+func (c *creator) failed() bool {
+	return len(c.errs) > 0
+}
+
+// rollback deletes every resource created, in reverse order of creation. It
+// runs with a context of its own, so that resources are still deleted after the
+// context of creation is cancelled.
+func (c *creator) rollback() []*ResourceError {
+	ctx := context.Background()
+	errs := make([]*ResourceError, 0)
+	for i := len(c.created) - 1; i >= 0; i-- {
+		t := c.created[i]
+		c.limiter.Accept()
+		if err := t.delete(ctx); err != nil && !errors.IsNotFound(err) {
+			fmt.Printf("- Failed to delete %s %q: %v\n", t.kind, t.name, err)
+			errs = append(errs, &ResourceError{Kind: t.kind, Name: t.name, Err: err})
+			continue
+		}
+		fmt.Printf("- Deleted %s %q.\n", t.kind, t.name)
+	}
+
+	return errs
+}
+
+// report prints resources created so far and resources failed to be created.
+func (c *creator) report() {
+	fmt.Printf("Created %d resources:\n", len(c.created))
+	for _, t := range c.created {
+		fmt.Printf("- %s %q\n", t.kind, t.name)
+	}
+	fmt.Printf("Failed to create %d resources:\n", len(c.errs))
+	for _, err := range c.errs {
+		fmt.Printf("- %s\n", err)
+	}
+}
+
+func deleteOptions() metav1.DeleteOptions {
+	propagation := metav1.DeletePropagationBackground
+	return metav1.DeleteOptions{
+		PropagationPolicy: &propagation,
+	}
+}
@@ -0,0 +1,376 @@
+package base
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// definitionHash returns a digest of def, stamped on deployed resources to
+// tell which definition they were deployed from.
+func (def SystemDefinition) definitionHash() (string, error) {
+	defJSON, err := json.Marshal(def)
+	if err != nil {
+		return "", err
+	}
+
+	sum := sha256.Sum256(defJSON)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// prepareAnnotations returns the annotations of resources of def, stamped
+// with the digest of def computed by prepareSystemDefinition.
+func prepareAnnotations(def SystemDefinition) map[string]string {
+	return map[string]string{
+		benDefinitionHash: def.hash,
+	}
+}
+
+// deployedUnit is a service version as running in the cluster, i.e. one
+// Deployment or StatefulSet.
+type deployedUnit struct {
+	id       int
+	service  string
+	version  string
+	svcType  string
+	image    string
+	replicas int32
+	workload Workload
+	calls    []Call
+	hash     string
+
+	// Fields below are only decoded to reconstruct definitions
+	live      bool
+	resources *Resources
+	node      string
+	zone      string
+	topology  string
+	delays    map[string]int // Zone latency by callee cluster IP
+	storage   *Storage
+	port      int
+	env       map[string]string
+	command   []string
+	args      []string
+}
+
+// listDeployedUnits reads every Deployment and StatefulSet of system deployed
+// in namespace.
+func listDeployedUnits(ctx context.Context, clientset kubernetes.Interface, namespace string, system string) ([]deployedUnit, error) {
+	selector := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/managed-by=%s,app.kubernetes.io/name=%s", labelManagedBy, system),
+	}
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, selector)
+	if err != nil {
+		return nil, err
+	}
+	workloads, err := listLiveWorkloads(ctx, clientset, namespace, system)
+	if err != nil {
+		return nil, err
+	}
+
+	decoder := unitDecoder{
+		clientset: clientset,
+		namespace: namespace,
+		system:    system,
+		workloads: workloads,
+	}
+	units := make([]deployedUnit, 0)
+	for _, deployment := range deployments.Items {
+		units = append(units, decoder.decode(ctx, deployment.ObjectMeta, deployment.Spec.Replicas, deployment.Spec.Template, nil))
+	}
+	for _, statefulSet := range statefulSets.Items {
+		units = append(units, decoder.decode(ctx, statefulSet.ObjectMeta, statefulSet.Spec.Replicas, statefulSet.Spec.Template, statefulSet.Spec.VolumeClaimTemplates))
+	}
+
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].key() < units[j].key()
+	})
+	return units, nil
+}
+
+func (u deployedUnit) key() string {
+	if u.version == "" {
+		return u.service
+	}
+
+	return u.service + "@" + u.version
+}
+
+// unitDecoder decodes VECRO_* env vars of deployed pod templates back into
+// workload and calls.
+type unitDecoder struct {
+	clientset kubernetes.Interface
+	namespace string
+	system    string
+	workloads map[string]string // Live workload ConfigMap data
+}
+
+func (d *unitDecoder) decode(ctx context.Context, meta metav1.ObjectMeta, replicas *int32, template apiv1.PodTemplateSpec, claims []apiv1.PersistentVolumeClaim) deployedUnit {
+	id, _ := strconv.Atoi(meta.Labels[benServiceID])
+	unit := deployedUnit{
+		id:       id,
+		service:  meta.Labels[benServiceName],
+		version:  meta.Labels[benServiceVersion],
+		svcType:  meta.Labels[benServiceType],
+		replicas: 1,
+		hash:     meta.Annotations[benDefinitionHash],
+	}
+	if replicas != nil {
+		unit.replicas = *replicas
+	}
+	if unit.svcType == "" {
+		unit.svcType = guessServiceType(unit.service, template.Spec)
+	}
+
+	unit.zone = meta.Labels[benZone]
+	unit.topology = template.Spec.NodeSelector[topologyZoneLabel]
+	unit.delays = decodeZoneDelays(template.Spec)
+	unit.node = affinityNode(template.Spec)
+	unit.storage = decodeStorage(claims)
+
+	container := findContainer(template.Spec, Service{Name: unit.service, Type: unit.svcType}.mainContainerName())
+	if container == nil {
+		return unit
+	}
+	unit.image = container.Image
+	unit.resources = decodeResources(container.Resources)
+
+	envs := make(map[string]string, len(container.Env))
+	for _, env := range container.Env {
+		envs[env.Name] = env.Value
+	}
+	if unit.svcType == "external" {
+		unit.env = envs
+		unit.command = container.Command
+		unit.args = container.Args
+		if len(container.Ports) > 0 {
+			unit.port = int(container.Ports[0].ContainerPort)
+		}
+		return unit
+	}
+	if _, ok := envs[workloadFileEnvKey]; ok {
+		unit.live = true
+		envs = parseWorkloadFile(d.workloads[workloadConfigKeyOf(template.Spec)])
+	}
+	unit.workload = fromWorkloadEnvVar(envs)
+	for _, env := range container.Env {
+		if env.Name == calleeEnvKey {
+			unit.calls = d.decodeCalls(ctx, env.Value)
+		}
+	}
+
+	return unit
+}
+
+func decodeResources(requirements apiv1.ResourceRequirements) *Resources {
+	if len(requirements.Requests) == 0 && len(requirements.Limits) == 0 {
+		return nil
+	}
+
+	amount := func(list apiv1.ResourceList) ResourceAmount {
+		var a ResourceAmount
+		if cpu, ok := list[apiv1.ResourceCPU]; ok {
+			a.CPU = cpu.String()
+		}
+		if memory, ok := list[apiv1.ResourceMemory]; ok {
+			a.Memory = memory.String()
+		}
+		return a
+	}
+
+	return &Resources{
+		Requests: amount(requirements.Requests),
+		Limits:   amount(requirements.Limits),
+	}
+}
+
+func decodeStorage(claims []apiv1.PersistentVolumeClaim) *Storage {
+	for _, claim := range claims {
+		if claim.Name != dataVolumeName {
+			continue
+		}
+
+		storage := &Storage{}
+		if size, ok := claim.Spec.Resources.Requests[apiv1.ResourceStorage]; ok {
+			storage.Size = size.String()
+		}
+		if claim.Spec.StorageClassName != nil {
+			storage.Class = *claim.Spec.StorageClassName
+		}
+		return storage
+	}
+
+	return nil
+}
+
+// listLiveWorkloads returns the live workload ConfigMap data of system, which
+// is empty if it's deployed without live workload.
+func listLiveWorkloads(ctx context.Context, clientset kubernetes.Interface, namespace string, system string) (map[string]string, error) {
+	configMap, err := clientset.CoreV1().ConfigMaps(namespace).Get(ctx, workloadConfigMapName(system), metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return map[string]string{}, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	return configMap.Data, nil
+}
+
+// decodeCalls reverses assembleCalls.
+func (d *unitDecoder) decodeCalls(ctx context.Context, value string) []Call {
+	if value == "" {
+		return nil
+	}
+
+	urls := strings.Split(value, calleeSeparator)
+	calls := make([]Call, 0, len(urls))
+	for _, url := range urls {
+		if strings.HasPrefix(url, "nats://") {
+			// nats://<system>-<broker>:<port>/<system>.<callee>
+			hostPath := strings.SplitN(strings.TrimPrefix(url, "nats://"), "/", 2)
+			host := strings.SplitN(hostPath[0], ":", 2)[0]
+			calls = append(calls, Call{
+				Name:   strings.TrimPrefix(hostPath[len(hostPath)-1], d.system+"."),
+				Async:  true,
+				Broker: strings.TrimPrefix(host, d.system+"-"),
+			})
+			continue
+		}
+
+		host := strings.TrimPrefix(url, "http://")
+		if strings.HasSuffix(host, ".svc.cluster.local") {
+			// http://<system>-<callee>.<namespace>.svc.cluster.local
+			parts := strings.SplitN(host, ".", 3)
+			calls = append(calls, Call{Name: d.decodeRemoteCall(ctx, parts[0], parts[1])})
+			continue
+		}
+		calls = append(calls, Call{Name: strings.TrimPrefix(host, d.system+"-")})
+	}
+
+	return calls
+}
+
+// decodeRemoteCall resolves the service of another system behind a Kubernetes
+// service name, as names of systems and services are both dash separated.
+func (d *unitDecoder) decodeRemoteCall(ctx context.Context, serviceName string, namespace string) string {
+	service, err := d.clientset.CoreV1().Services(namespace).Get(ctx, serviceName, metav1.GetOptions{})
+	if err != nil {
+		return serviceName
+	}
+
+	system := service.Labels["app.kubernetes.io/name"]
+	return system + systemSeparator + strings.TrimPrefix(serviceName, system+"-")
+}
+
+// mainContainerName returns the name of the container svc assembles its
+// workload config to.
+func (svc Service) mainContainerName() string {
+	switch svc.Type {
+	case "mongodb":
+		return svc.Name + "-agent"
+	case "broker":
+		return svc.Name + "-broker"
+	default:
+		return svc.Name
+	}
+}
+
+func defaultImage(svcType string) string {
+	switch svcType {
+	case "base", "cache":
+		return baseImageName
+	case "mongodb":
+		return mongoDBImageName
+	case "broker":
+		return brokerImageName
+	default:
+		return ""
+	}
+}
+
+// guessServiceType infers the type of services deployed before service types
+// were labelled.
+func guessServiceType(name string, spec apiv1.PodSpec) string {
+	if findContainer(spec, name+"-mongodb") != nil {
+		return "mongodb"
+	}
+	if findContainer(spec, name+"-broker") != nil {
+		return "broker"
+	}
+
+	container := findContainer(spec, name)
+	if container == nil {
+		return ""
+	}
+	for _, env := range container.Env {
+		if env.Name == cacheShortCircuitEnvKey {
+			return "cache"
+		}
+	}
+	for _, env := range container.Env {
+		if env.Name == nameEnvKey {
+			return "base"
+		}
+	}
+
+	return "external"
+}
+
+func findContainer(spec apiv1.PodSpec, name string) *apiv1.Container {
+	for i := range spec.Containers {
+		if spec.Containers[i].Name == name {
+			return &spec.Containers[i]
+		}
+	}
+
+	return nil
+}
+
+func workloadConfigKeyOf(spec apiv1.PodSpec) string {
+	for _, volume := range spec.Volumes {
+		if volume.Name == workloadVolumeName && volume.ConfigMap != nil && len(volume.ConfigMap.Items) > 0 {
+			return volume.ConfigMap.Items[0].Key
+		}
+	}
+
+	return ""
+}
+
+// prepareUnits returns the units def deploys, for comparison with the units
+// actually deployed.
+func prepareUnits(def SystemDefinition) []deployedUnit {
+	units := make([]deployedUnit, 0)
+	for _, svc := range def.Services {
+		replicas := svc.versionReplicas(def.Replicas)
+		for i, version := range svc.versions() {
+			versioned := svc.withVersion(version)
+			units = append(units, deployedUnit{
+				service:  svc.Name,
+				version:  version.Name,
+				svcType:  svc.Type,
+				image:    versioned.imageOr(defaultImage(svc.Type)),
+				replicas: replicas[i],
+				workload: versioned.Workload,
+				calls:    svc.Calls,
+			})
+		}
+	}
+
+	sort.Slice(units, func(i, j int) bool {
+		return units[i].key() < units[j].key()
+	})
+	return units
+}
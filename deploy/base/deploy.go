@@ -5,6 +5,8 @@ import (
 	"fmt"
 	appsv1 "k8s.io/api/apps/v1"
 	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/api/resource"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/util/intstr"
@@ -27,65 +29,175 @@ const subsystemEnvKey = "VECRO_SUBSYSTEM"
 const listenAddressEnvKey = "VECRO_LISTEN_ADDRESS"
 const calleeEnvKey = "VECRO_CALLS"
 const calleeSeparator = " "
+const cacheShortCircuitEnvKey = "VECRO_CACHE_SHORT_CIRCUIT"
+
+// Access patterns of cache workload.
+const (
+	cachePatternSequential = "sequential"
+	cachePatternRandom     = "random"
+	cachePatternZipf       = "zipf"
+)
 
 const benServiceName = "vecro-sim/service-name"
 const benServiceID = "vecro-sim/service-id"
+const benServiceType = "vecro-sim/service-type"
+const benDefinitionHash = "vecro-sim/definition-hash"
+
+func prepareSystemDefinition(def *SystemDefinition) error {
+	if err := resolveBrokers(def); err != nil {
+		return err
+	}
+
+	hash, err := def.definitionHash()
+	if err != nil {
+		return err
+	}
+	def.hash = hash
 
-func prepareSystemDefinition(def *SystemDefinition) {
-	// Currently there's no need for preparation
+	return nil
 }
 
-func prepareDeployments(def SystemDefinition) []*appsv1.Deployment {
-	deployments := make([]*appsv1.Deployment, len(def.Services))
+func prepareDeployments(def SystemDefinition) ([]*appsv1.Deployment, error) {
+	deployments := make([]*appsv1.Deployment, 0, len(def.Services))
 	for i, svc := range def.Services {
-		deployment := &appsv1.Deployment{
-			ObjectMeta: metav1.ObjectMeta{
-				Name:      def.Name + "-" + svc.Name,
-				Namespace: def.Namespace,
-				Labels: map[string]string{
-					"app.kubernetes.io/name":       def.Name,
-					"app.kubernetes.io/managed-by": labelManagedBy,
-					benServiceName:                 svc.Name,
-					benServiceID:                   strconv.Itoa(i),
+		if svc.isStateful() {
+			continue
+		}
+
+		replicas := svc.versionReplicas(def.Replicas)
+		for j, version := range svc.versions() {
+			labels, selector := prepareLabels(def, svc, i, version)
+			template, err := preparePodTemplate(def, svc.withVersion(version), labels)
+			if err != nil {
+				return nil, err
+			}
+			deployment := &appsv1.Deployment{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        version.resourceName(def.Name, svc.Name),
+					Namespace:   def.Namespace,
+					Labels:      labels,
+					Annotations: prepareAnnotations(def),
 				},
-			},
-			Spec: appsv1.DeploymentSpec{
-				Replicas: int32Ptr(def.Replicas),
-				Selector: &metav1.LabelSelector{
-					MatchLabels: map[string]string{
-						"app.kubernetes.io/name":       def.Name,
-						"app.kubernetes.io/managed-by": labelManagedBy,
-						benServiceName:                 svc.Name,
+				Spec: appsv1.DeploymentSpec{
+					Replicas: int32Ptr(replicas[j]),
+					Selector: &metav1.LabelSelector{
+						MatchLabels: selector,
 					},
+					Template: template,
 				},
-				Template: apiv1.PodTemplateSpec{
-					ObjectMeta: metav1.ObjectMeta{
-						Labels: map[string]string{
-							"app.kubernetes.io/name":       def.Name,
-							"app.kubernetes.io/managed-by": labelManagedBy,
-							benServiceName:                 svc.Name,
-							benServiceID:                   strconv.Itoa(i),
+				Status: appsv1.DeploymentStatus{},
+			}
+
+			deployments = append(deployments, deployment)
+		}
+	}
+
+	return deployments, nil
+}
+
+// prepareLabels returns the labels of resources of a service version, and the
+// subset of them selecting its pods.
+func prepareLabels(def SystemDefinition, svc Service, id int, version Version) (map[string]string, map[string]string) {
+	labels := map[string]string{
+		"app.kubernetes.io/name":       def.Name,
+		"app.kubernetes.io/managed-by": labelManagedBy,
+		benServiceName:                 svc.Name,
+		benServiceID:                   strconv.Itoa(id),
+		benServiceType:                 svc.Type,
+	}
+	selector := map[string]string{
+		"app.kubernetes.io/name":       def.Name,
+		"app.kubernetes.io/managed-by": labelManagedBy,
+		benServiceName:                 svc.Name,
+	}
+	if version.Name != "" {
+		labels[benServiceVersion] = version.Name
+		selector[benServiceVersion] = version.Name
+	}
+	if svc.Zone != "" {
+		labels[benZone] = svc.Zone
+	}
+
+	return labels, selector
+}
+
+func preparePodTemplate(def SystemDefinition, svc Service, labels map[string]string) (apiv1.PodTemplateSpec, error) {
+	initContainers, err := prepareZoneInitContainers(svc, def)
+	if err != nil {
+		return apiv1.PodTemplateSpec{}, err
+	}
+	containers, err := prepareContainers(svc, def)
+	if err != nil {
+		return apiv1.PodTemplateSpec{}, err
+	}
+	nodeSelector, err := prepareZoneNodeSelector(svc, def)
+	if err != nil {
+		return apiv1.PodTemplateSpec{}, err
+	}
+
+	return apiv1.PodTemplateSpec{
+		ObjectMeta: metav1.ObjectMeta{
+			Labels: labels,
+		},
+		Spec: apiv1.PodSpec{
+			InitContainers: initContainers,
+			Containers:     containers,
+			Volumes:        prepareVolumes(svc, def),
+			NodeSelector:   nodeSelector,
+			Affinity:       prepareNodeAffinity(svc),
+		},
+	}, nil
+}
+
+// prepareNodeAffinity places pods of svc on the node of its name, which may
+// differ from the hostname label of the node. Pods still go through the
+// scheduler, unlike those given a node name directly.
+func prepareNodeAffinity(svc Service) *apiv1.Affinity {
+	if svc.Node == "" {
+		return nil
+	}
+
+	return &apiv1.Affinity{
+		NodeAffinity: &apiv1.NodeAffinity{
+			RequiredDuringSchedulingIgnoredDuringExecution: &apiv1.NodeSelector{
+				NodeSelectorTerms: []apiv1.NodeSelectorTerm{
+					{
+						MatchFields: []apiv1.NodeSelectorRequirement{
+							{
+								Key:      nodeNameField,
+								Operator: apiv1.NodeSelectorOpIn,
+								Values:   []string{svc.Node},
+							},
 						},
 					},
-					Spec: apiv1.PodSpec{
-						Containers: prepareContainers(svc, def.Name),
-						Volumes: prepareVolumes(svc),
-					},
 				},
 			},
-			Status: appsv1.DeploymentStatus{},
-		}
+		},
+	}
+}
 
-		deployments[i] = deployment
+// affinityNode returns the node pods of spec are placed on by
+// prepareNodeAffinity, if any.
+func affinityNode(spec apiv1.PodSpec) string {
+	if spec.Affinity == nil || spec.Affinity.NodeAffinity == nil ||
+		spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return ""
+	}
+	for _, term := range spec.Affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		for _, requirement := range term.MatchFields {
+			if requirement.Key == nodeNameField && requirement.Operator == apiv1.NodeSelectorOpIn && len(requirement.Values) == 1 {
+				return requirement.Values[0]
+			}
+		}
 	}
 
-	return deployments
+	return ""
 }
 
-func prepareVolumes(svc Service) []apiv1.Volume {
+func prepareVolumes(svc Service, def SystemDefinition) []apiv1.Volume {
 	volumes := make([]apiv1.Volume, 0)
 	switch svc.Type {
-	case "base":
+	case "base", "cache":
 		volume := apiv1.Volume{
 			Name:         "tmp-io-dir",
 			VolumeSource: apiv1.VolumeSource{
@@ -107,18 +219,61 @@ func prepareVolumes(svc Service) []apiv1.Volume {
 		}
 		volumes = append(volumes, volume)
 	}
-	
+	volumes = append(volumes, prepareWorkloadVolumes(svc, def)...)
+
 	return volumes
 }
 
-func prepareContainers(svc Service, sysName string) []apiv1.Container {
+// Container selectors of ContainerNames.
+const (
+	ContainerMain  = ""      // The container serving requests to the service
+	ContainerAgent = "agent" // The agent container
+	ContainerDB    = "db"    // The container keeping data of database & broker services
+	ContainerAll   = "all"   // Every container
+)
+
+// ContainerNames returns names of containers selected by selector, as
+// prepareContainers names them for a service of svcType. No name is returned
+// if the service has no such container.
+func ContainerNames(svcType string, svcName string, selector string) []string {
+	svc := Service{Name: svcName, Type: svcType}
+	var agent, db []string
+	switch svcType {
+	case "mongodb":
+		agent, db = []string{svcName + "-agent"}, []string{svcName + "-mongodb"}
+	case "broker":
+		agent, db = []string{svcName + "-agent"}, []string{svcName + "-broker"}
+	default:
+		agent = []string{svcName}
+	}
+
+	switch selector {
+	case ContainerMain:
+		return []string{svc.mainContainerName()}
+	case ContainerAgent:
+		return agent
+	case ContainerDB:
+		return db
+	case ContainerAll:
+		return append(db, agent...)
+	default:
+		return nil
+	}
+}
+
+func prepareContainers(svc Service, def SystemDefinition) ([]apiv1.Container, error) {
+	sysName := def.Name
 	containers := make([]apiv1.Container, 0)
 
 	switch svc.Type {
-	case "base":
+	case "base", "cache":
+		calls, err := assembleCalls(svc.Calls, def)
+		if err != nil {
+			return nil, err
+		}
 		container := apiv1.Container{
 			Name:  svc.Name,
-			Image: baseImageName,
+			Image: svc.imageOr(baseImageName),
 			Ports: []apiv1.ContainerPort{
 				{
 					// No longer set port names because it doesn't support name longer than 15 characters.
@@ -138,7 +293,11 @@ func prepareContainers(svc Service, sysName string) []apiv1.Container {
 				},
 				{
 					Name:  calleeEnvKey,
-					Value: assembleCalls(svc.Calls, sysName),
+					Value: calls,
+				},
+				{
+					Name:  subscriptionEnvKey,
+					Value: assembleSubscriptions(svc, def),
 				},
 				{
 					Name:  listenAddressEnvKey,
@@ -153,7 +312,7 @@ func prepareContainers(svc Service, sysName string) []apiv1.Container {
 			},
 			Resources: apiv1.ResourceRequirements{
 				Limits: apiv1.ResourceList{
-					apiv1.ResourceCPU: resource.MustParse("700m"), // TODO: make cpu resource request & limit configurable
+					apiv1.ResourceCPU: resource.MustParse("700m"),
 					apiv1.ResourceMemory: resource.MustParse("250Mi"),
 				},
 				Requests: apiv1.ResourceList{
@@ -163,14 +322,27 @@ func prepareContainers(svc Service, sysName string) []apiv1.Container {
 			},
 		}
 
-		// Assemble service workload config to base container
-		container.Env = append(container.Env, svc.toWorkloadEnvVar()...)
+		// Override default resources & assemble service workload config to base container
+		svc.Resources.applyTo(&container.Resources)
+		container.Env = append(container.Env, prepareWorkloadEnvVar(svc, def)...)
+		container.VolumeMounts = append(container.VolumeMounts, prepareWorkloadVolumeMounts(def)...)
+		if svc.Type == "cache" {
+			// Cache services call down-stream databases only on cache misses
+			databases, err := assembleCalls(databaseCalls(svc, def), def)
+			if err != nil {
+				return nil, err
+			}
+			container.Env = append(container.Env, apiv1.EnvVar{
+				Name:  cacheShortCircuitEnvKey,
+				Value: databases,
+			})
+		}
 		containers = append(containers, container)
 
 	case "mongodb":
 		baseContainer := apiv1.Container{
 			Name:  svc.Name + "-agent",
-			Image: mongoDBImageName,
+			Image: svc.imageOr(mongoDBImageName),
 			Ports: []apiv1.ContainerPort{
 				{
 					//Name:          svc.Name + "-port",
@@ -194,7 +366,7 @@ func prepareContainers(svc Service, sysName string) []apiv1.Container {
 			},
 			Resources: apiv1.ResourceRequirements{
 				Limits: apiv1.ResourceList{
-					apiv1.ResourceCPU: resource.MustParse("1000m"), // TODO: make cpu resource request & limit configurable
+					apiv1.ResourceCPU: resource.MustParse("1000m"),
 					apiv1.ResourceMemory: resource.MustParse("1.25Gi"),
 				},
 				Requests: apiv1.ResourceList{
@@ -229,10 +401,14 @@ func prepareContainers(svc Service, sysName string) []apiv1.Container {
 					Name:      "init-script",
 					MountPath: "/docker-entrypoint-initdb.d/mongo-init.js",
 				},
+				{
+					Name:      dataVolumeName,
+					MountPath: "/data/db",
+				},
 			},
 			Resources: apiv1.ResourceRequirements{
 				Limits: apiv1.ResourceList{
-					apiv1.ResourceCPU: resource.MustParse("1000m"), // TODO: make cpu resource request & limit configurable
+					apiv1.ResourceCPU: resource.MustParse("1000m"), // TODO: make database resource request & limit configurable
 				},
 				Requests: apiv1.ResourceList{
 					apiv1.ResourceCPU: resource.MustParse("250m"),
@@ -240,37 +416,79 @@ func prepareContainers(svc Service, sysName string) []apiv1.Container {
 			},
 		}
 		
-		// Assemble service workload config to mongodb container
-		baseContainer.Env = append(baseContainer.Env, svc.toWorkloadEnvVar()...)
+		// Override default resources & assemble service workload config to mongodb container
+		svc.Resources.applyTo(&baseContainer.Resources)
+		baseContainer.Env = append(baseContainer.Env, prepareWorkloadEnvVar(svc, def)...)
+		baseContainer.VolumeMounts = append(baseContainer.VolumeMounts, prepareWorkloadVolumeMounts(def)...)
 		containers = append(containers, baseContainer, mongoDBContainer)
+
+	case "external":
+		container, err := prepareExternalContainer(svc, def)
+		if err != nil {
+			return nil, err
+		}
+		containers = append(containers, container)
+
+	case "broker":
+		containers = append(containers, prepareBrokerContainers(svc)...)
 	}
 
-	return containers
+	return containers, nil
 }
 
-func commitDeployment(deploymentsClient clientappsv1.DeploymentInterface, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
-	return deploymentsClient.Create(context.TODO(), deployment, metav1.CreateOptions{})
+func commitDeployment(ctx context.Context, deploymentsClient clientappsv1.DeploymentInterface, deployment *appsv1.Deployment) (*appsv1.Deployment, error) {
+	return deploymentsClient.Create(ctx, deployment, metav1.CreateOptions{})
 }
 
-func createDeployment(clientset *kubernetes.Clientset, def SystemDefinition) {
-	deployments := prepareDeployments(def)
+func createDeploymentTasks(clientset kubernetes.Interface, def SystemDefinition) ([]task, error) {
+	deployments, err := prepareDeployments(def)
+	if err != nil {
+		return nil, err
+	}
 
 	//fmt.Printf("%#v\n", deployments)
 	deploymentsClient := clientset.AppsV1().Deployments(def.Namespace)
+	tasks := make([]task, len(deployments))
 	for i, deployment := range deployments {
-		result, err := commitDeployment(deploymentsClient, deployment)
-		if err != nil {
-			panic(err)
+		deployment := deployment
+		tasks[i] = task{
+			kind: "deployment",
+			name: deployment.Name,
+			create: func(ctx context.Context) error {
+				_, err := commitDeployment(ctx, deploymentsClient, deployment)
+				return err
+			},
+			delete: func(ctx context.Context) error {
+				return deploymentsClient.Delete(ctx, deployment.Name, deleteOptions())
+			},
 		}
-		fmt.Printf("- Created deployment %d: %q.\n", i, result.GetObjectMeta().GetName())
 	}
-	fmt.Printf("Created deployments for %q.\n", def.Name)
+
+	return tasks, nil
 }
 
-func prepareServices(def SystemDefinition) []*apiv1.Service {
+// createPodTasks returns tasks creating deployments and stateful sets of def.
+func createPodTasks(clientset kubernetes.Interface, def SystemDefinition) ([]task, error) {
+	tasks, err := createDeploymentTasks(clientset, def)
+	if err != nil {
+		return nil, err
+	}
+	statefulSetTasks, err := createStatefulSetTasks(clientset, def)
+	if err != nil {
+		return nil, err
+	}
+
+	return append(tasks, statefulSetTasks...), nil
+}
+
+func prepareServices(def SystemDefinition) ([]*apiv1.Service, error) {
 	services := make([]*apiv1.Service, len(def.Services))
 
 	for i, svc := range def.Services {
+		svcType, err := serviceType(def.exposure(svc))
+		if err != nil {
+			return nil, err
+		}
 		service := &apiv1.Service{
 			ObjectMeta: metav1.ObjectMeta{
 				Name:      def.Name + "-" + svc.Name,
@@ -278,6 +496,7 @@ func prepareServices(def SystemDefinition) []*apiv1.Service {
 				//Annotations: map[string]string{
 				//	"prometheus.io/scrape": "true", // For Prometheus to scrape metrics
 				//},
+				Annotations: prepareAnnotations(def),
 				Labels: map[string]string{
 					"app.kubernetes.io/name":       def.Name,
 					"app.kubernetes.io/managed-by": labelManagedBy,
@@ -286,11 +505,12 @@ func prepareServices(def SystemDefinition) []*apiv1.Service {
 			Spec: apiv1.ServiceSpec{
 				Ports: []apiv1.ServicePort{
 					{
-						// Service names serve as endpoint names
-						//Name:       svc.Name,
-						Protocol:   "TCP",
-						Port:       int32(baseExposedPort),
-						TargetPort: intstr.FromInt(baseListeningPort),
+						// Service names exceed the length limit of port names
+						Name:        svc.protocol(),
+						AppProtocol: stringPtr(svc.protocol()),
+						Protocol:    "TCP",
+						Port:       int32(svc.exposedPort()),
+						TargetPort: intstr.FromInt(svc.listeningPort()),
 					},
 				},
 				Selector: map[string]string{
@@ -298,61 +518,325 @@ func prepareServices(def SystemDefinition) []*apiv1.Service {
 					"app.kubernetes.io/managed-by": labelManagedBy,
 					benServiceName:                 svc.Name,
 				},
-				Type: "ClusterIP",
+				Type: svcType,
 			},
 		}
 
 		services[i] = service
 	}
 
-	return services
+	// Stateful services are additionally governed by headless services, which
+	// give their pods stable network identities.
+	for _, svc := range def.Services {
+		if svc.isStateful() {
+			services = append(services, prepareHeadlessService(def, svc))
+		}
+	}
+
+	return services, nil
 }
 
-func commitService(serviceClient clientcorev1.ServiceInterface, service *apiv1.Service) (*apiv1.Service, error) {
-	return serviceClient.Create(context.TODO(), service, metav1.CreateOptions{})
+func commitService(ctx context.Context, serviceClient clientcorev1.ServiceInterface, service *apiv1.Service) (*apiv1.Service, error) {
+	return serviceClient.Create(ctx, service, metav1.CreateOptions{})
 }
 
-func createService(clientset *kubernetes.Clientset, def SystemDefinition) {
-	services := prepareServices(def)
+// createServiceTasks returns tasks creating services of def, which store
+// created or already existing services in results.
+func createServiceTasks(clientset kubernetes.Interface, def SystemDefinition, results []*apiv1.Service) ([]task, error) {
+	services, err := prepareServices(def)
+	if err != nil {
+		return nil, err
+	}
 
 	//fmt.Printf("%#v\n", service)
 	serviceClient := clientset.CoreV1().Services(def.Namespace)
+	tasks := make([]task, len(services))
 	for i, service := range services {
-		result, err := commitService(serviceClient, service)
-		if err != nil {
-			panic(err)
+		i, service := i, service
+		tasks[i] = task{
+			kind: "service",
+			name: service.Name,
+			create: func(ctx context.Context) error {
+				result, err := commitService(ctx, serviceClient, service)
+				if errors.IsAlreadyExists(err) {
+					// Cluster IPs of existing services are needed all the same
+					existing, getErr := serviceClient.Get(ctx, service.Name, metav1.GetOptions{})
+					if getErr != nil {
+						return getErr
+					}
+					result = existing
+				}
+				// Headless services appended are not needed by results
+				if i < len(results) {
+					results[i] = result
+				}
+				return err
+			},
+			delete: func(ctx context.Context) error {
+				return serviceClient.Delete(ctx, service.Name, deleteOptions())
+			},
 		}
-		fmt.Printf("- Created service %d: %q.\n", i, result.GetObjectMeta().GetName())
 	}
-	fmt.Printf("Created services for %q.\n", def.Name)
+
+	return tasks, nil
 }
 
-func assembleCalls(calls []string, systemName string) string {
+func assembleCalls(calls []Call, def SystemDefinition) (string, error) {
 	if len(calls) == 0 {
-		return ""
+		return "", nil
 	}
 
 	urls := make([]string, len(calls))
 	for i, call := range calls {
 		//"http://info-service.app.svc.cluster.local/info"
 		//"http://service-name.namespace.svc.cluster.local:port"
-		urls[i] = fmt.Sprintf("http://%s-%s", systemName, call)
+		system, callee := def.Name, call.Name
+		if strings.Contains(call.Name, systemSeparator) {
+			system, callee = splitCall(call.Name)
+		}
+
+		if call.Async {
+			if system != def.Name {
+				return "", fmt.Errorf("async call to %q crosses systems, which is not supported", call.Name)
+			}
+			urls[i] = queueURL(def.Name, call.Broker, callee)
+		} else if system != def.Name {
+			namespace, err := def.namespaceOf(system)
+			if err != nil {
+				return "", err
+			}
+			urls[i] = fmt.Sprintf("http://%s-%s.%s.svc.cluster.local", system, callee, namespace)
+		} else {
+			urls[i] = fmt.Sprintf("http://%s-%s", system, callee)
+		}
+	}
+
+	return strings.Join(urls, calleeSeparator), nil
+}
+
+// DeployResult describes a system deployed by Deploy.
+type DeployResult struct {
+	System    string
+	Namespace string
+	Created   int               // Number of resources created
+	Skipped   int               // Number of resources already existing
+	URLs      map[string]string // URLs of exposed services by service name
+}
+
+// DefinitionError reports a system definition that could not be deployed.
+type DefinitionError struct {
+	System string
+	Reason string
+}
+
+func (e *DefinitionError) Error() string {
+	return fmt.Sprintf("invalid definition of %q: %s", e.System, e.Reason)
+}
+
+// Deploy deploys def to the cluster. Resources are created concurrently, and
+// on failure either rolled back or kept for deploying again to resume, as
+// configured in opts. Errors are *DefinitionError, *ResourceError creating the
+// namespace or *CreateError.
+func Deploy(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition, opts CreateOptions) (*DeployResult, error) {
+	results, err := DeployAll(ctx, clientset, []SystemDefinition{def}, opts)
+	if len(results) == 0 {
+		return nil, err
+	}
+
+	return results[0], err
+}
+
+// DeployAll deploys composed defs one after another like Deploy. If one of
+// them fails, systems deployed before it are rolled back along with it, in
+// reverse order, unless resources are kept as configured in opts. Results of
+// systems not deployed are omitted.
+func DeployAll(ctx context.Context, clientset kubernetes.Interface, defs []SystemDefinition, opts CreateOptions) ([]*DeployResult, error) {
+	// Every definition is validated before anything is created
+	defs = append([]SystemDefinition(nil), defs...)
+	for i := range defs {
+		if err := validateDefinition(&defs[i]); err != nil {
+			return nil, err
+		}
+		if defs[i].Mesh == meshIstio && opts.Dynamic == nil {
+			return nil, &DefinitionError{System: defs[i].Name, Reason: "istio mesh requires a dynamic client to create mesh objects"}
+		}
+	}
+
+	results := make([]*DeployResult, 0, len(defs))
+	creators := make([]*creator, 0, len(defs))
+	for _, def := range defs {
+		c := newCreator(opts)
+		result, err := deploySystem(ctx, clientset, def, c)
+		if result != nil {
+			results = append(results, result)
+			creators = append(creators, c)
+		}
+		if err == nil {
+			continue
+		}
+		switch err.(type) {
+		case *CreateError, *ResourceError:
+		default:
+			return results, err
+		}
+
+		if opts.OnError == OnErrorKeep {
+			c.report()
+			fmt.Printf("Deploy %q again to resume.\n", def.Name)
+			return results, err
+		}
+		rollbackErrs := make([]*ResourceError, 0)
+		for i := len(creators) - 1; i >= 0; i-- {
+			fmt.Printf("Rolling back %q...\n", results[i].System)
+			rollbackErrs = append(rollbackErrs, creators[i].rollback()...)
+			results[i].Created = 0
+		}
+		switch err := err.(type) {
+		case *CreateError:
+			err.Errors = append(err.Errors, rollbackErrs...)
+			err.RolledBack = true
+			return results, err
+		case *ResourceError:
+			return results, &CreateError{
+				System:     def.Name,
+				Errors:     append([]*ResourceError{err}, rollbackErrs...),
+				RolledBack: true,
+			}
+		}
 	}
 
-	return strings.Join(urls, calleeSeparator)
+	return results, nil
 }
 
-func CreateResources(clientset *kubernetes.Clientset, def SystemDefinition) {
-	// TODO: Create k8s namespace
+// deploySystem creates resources of def validated by c, without rolling them
+// back on failure. No result is returned if the namespace failed to be created.
+func deploySystem(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition, c *creator) (*DeployResult, error) {
+	services := make([]*apiv1.Service, len(def.Services))
+	var ingress *networkingv1.Ingress
+	serviceTasks, err := createServiceTasks(clientset, def, services)
+	if err != nil {
+		return nil, &DefinitionError{System: def.Name, Reason: err.Error()}
+	}
+	if err := createNamespace(ctx, clientset, def); err != nil {
+		return nil, err
+	}
 
-	prepareSystemDefinition(&def)
-	fmt.Printf("Creating deployment...\n")
-	createDeployment(clientset, def)
-	fmt.Printf("Done.\nCreating service...\n")
-	createService(clientset, def)
+	// Services are created first as zone latency is applied by callee cluster IPs
+	fmt.Printf("Creating service...\n")
+	tasks := createWorkloadConfigMapTasks(clientset, def)
+	tasks = append(tasks, serviceTasks...)
+	tasks = append(tasks, createIngressTasks(clientset, def, &ingress)...)
+	c.run(ctx, tasks)
+
+	if !c.failed() {
+		def.clusterIPs = make(map[string]string, len(def.Services))
+		for i, svc := range def.Services {
+			def.clusterIPs[svc.Name] = services[i].Spec.ClusterIP
+		}
+		fmt.Printf("Done.\nCreating deployment...\n")
+		tasks, err := createPodTasks(clientset, def)
+		if err != nil {
+			// Pods are only prepared once cluster IPs are known, after
+			// services are created, which are rolled back like on failure
+			c.record(task{kind: "pod template", name: def.Name}, err)
+		} else {
+			if def.Mesh == meshIstio {
+				tasks = append(tasks, createMeshTasks(c.dynamic, def, services)...)
+			}
+			c.run(ctx, tasks)
+		}
+	}
+
+	result := &DeployResult{
+		System:    def.Name,
+		Namespace: def.Namespace,
+		Created:   len(c.created),
+		Skipped:   c.skipped,
+	}
+	if c.failed() {
+		return result, &CreateError{
+			System: def.Name,
+			Errors: c.errs,
+		}
+	}
 	fmt.Printf("Done.\n")
 
 	// TODO: Create Prometheus Resource.
+	// Resources are all created by now, so a failed lookup is no reason to
+	// roll them back
+	urls, err := exposedURLs(ctx, clientset, def, services, ingress)
+	if err != nil {
+		fmt.Printf("Warning: exposed URLs of %q could not be resolved: %v.\n", def.Name, err)
+		urls = map[string]string{}
+	}
+	result.URLs = urls
+	return result, nil
+}
+
+// validateDefinition prepares def and checks every resource of it could be
+// prepared, so that invalid definitions are reported before anything is
+// created.
+func validateDefinition(def *SystemDefinition) error {
+	if err := prepareSystemDefinition(def); err != nil {
+		return &DefinitionError{System: def.Name, Reason: err.Error()}
+	}
+
+	validators := []func(SystemDefinition) error{
+		validateCalls,
+		validateExposure,
+		validateExternal,
+		validateZones,
+		validateResources,
+		validateWorkloads,
+		validateMesh,
+		validateVersions,
+		validatePreparation,
+	}
+	for _, validate := range validators {
+		if err := validate(*def); err != nil {
+			return &DefinitionError{System: def.Name, Reason: err.Error()}
+		}
+	}
+
+	return nil
+}
+
+// validatePreparation checks services and pods of def could be prepared.
+// Zone latency of pods is left out, as cluster IPs are not known yet.
+func validatePreparation(def SystemDefinition) error {
+	if _, err := prepareServices(def); err != nil {
+		return err
+	}
+	if _, err := prepareDeployments(def); err != nil {
+		return err
+	}
+	_, err := prepareStatefulSets(def)
+	return err
 }
 
 func int32Ptr(i int32) *int32 { return &i }
+
+func stringPtr(s string) *string { return &s }
+
+// databaseCalls returns calls of svc to database services of its own system,
+// which a cache service skips on cache hits.
+func databaseCalls(svc Service, def SystemDefinition) []Call {
+	calls := make([]Call, 0)
+	for _, call := range svc.Calls {
+		if callee := def.service(call.Name); callee != nil && !call.Async && callee.isDatabase() {
+			calls = append(calls, call)
+		}
+	}
+
+	return calls
+}
+
+// isDatabase reports whether svc is a database service.
+func (svc Service) isDatabase() bool {
+	switch svc.Type {
+	case "mongodb", "mysql", "redis":
+		return true
+	default:
+		return false
+	}
+}
@@ -0,0 +1,252 @@
+package base
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func loadTestDefinition(t *testing.T, name string) SystemDefinition {
+	t.Helper()
+	def, err := LoadSystemDefinition("simple.yaml", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	def.Name, def.Namespace = name, name
+	for i := range def.Services {
+		def.Services[i].Type = "base"
+	}
+
+	return def
+}
+
+func TestDeployAllRollsBackComposedSystems(t *testing.T) {
+	defs, err := Compose([]SystemDefinition{
+		loadTestDefinition(t, "first"),
+		loadTestDefinition(t, "second"),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("create", "deployments", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		if action.GetNamespace() == "second" {
+			return true, nil, errors.New("quota exceeded")
+		}
+		return false, nil, nil
+	})
+
+	results, err := DeployAll(context.Background(), clientset, defs, CreateOptions{QPS: 1000})
+	var createErr *CreateError
+	if !errors.As(err, &createErr) || !createErr.RolledBack || createErr.System != "second" {
+		t.Fatalf("got error %v, want *CreateError of second rolled back", err)
+	}
+	if len(results) != 2 {
+		t.Fatalf("got %d results, want 2", len(results))
+	}
+
+	for _, namespace := range []string{"first", "second"} {
+		deployments, _ := clientset.AppsV1().Deployments(namespace).List(context.Background(), metav1.ListOptions{})
+		services, _ := clientset.CoreV1().Services(namespace).List(context.Background(), metav1.ListOptions{})
+		if len(deployments.Items) > 0 || len(services.Items) > 0 {
+			t.Errorf("got %d deployments & %d services left in %q, want none", len(deployments.Items), len(services.Items), namespace)
+		}
+	}
+}
+
+func TestDeployFailsOnExistingServiceUnreadable(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	clientset := fake.NewSimpleClientset(&apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{Name: "simple-a", Namespace: "simple"},
+	})
+	clientset.PrependReactor("get", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+
+	_, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000})
+	var createErr *CreateError
+	if !errors.As(err, &createErr) {
+		t.Fatalf("got error %v, want *CreateError", err)
+	}
+}
+
+func TestDeployAndTeardown(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	clientset := fake.NewSimpleClientset()
+
+	result, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	deployments, err := clientset.AppsV1().Deployments("simple").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(deployments.Items) != len(def.Services) || result.Created == 0 {
+		t.Fatalf("got %d deployments & %d resources created, want %d deployments", len(deployments.Items), result.Created, len(def.Services))
+	}
+
+	differences, err := Diff(context.Background(), clientset, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if differences != 0 {
+		t.Errorf("got %d differences right after deploying, want none", differences)
+	}
+
+	if _, err := Teardown(context.Background(), clientset, nil, def); err != nil {
+		t.Fatal(err)
+	}
+	deployments, _ = clientset.AppsV1().Deployments("simple").List(context.Background(), metav1.ListOptions{})
+	services, _ := clientset.CoreV1().Services("simple").List(context.Background(), metav1.ListOptions{})
+	if len(deployments.Items) > 0 || len(services.Items) > 0 {
+		t.Errorf("got %d deployments & %d services left, want none", len(deployments.Items), len(services.Items))
+	}
+}
+
+func TestValidateDefinition(t *testing.T) {
+	tests := []struct {
+		name   string
+		modify func(def *SystemDefinition)
+	}{
+		{"ambiguous broker", func(def *SystemDefinition) {
+			def.Services[0].Calls = append(def.Services[0].Calls, Call{Name: "b", Async: true})
+		}},
+		{"async call across systems", func(def *SystemDefinition) {
+			def.Services[0].Calls = append(def.Services[0].Calls, Call{Name: "other/b", Async: true, Broker: "q"})
+		}},
+		{"unknown async callee", func(def *SystemDefinition) {
+			def.Services[4].Type = "broker"
+			def.Services[0].Calls = append(def.Services[0].Calls, Call{Name: "x", Async: true, Broker: "e"})
+		}},
+		{"broker not a broker service", func(def *SystemDefinition) {
+			def.Services[0].Calls = append(def.Services[0].Calls, Call{Name: "b", Async: true, Broker: "c"})
+		}},
+		{"system not composed", func(def *SystemDefinition) {
+			def.Services[0].Calls = append(def.Services[0].Calls, Call{Name: "other/b"})
+		}},
+		{"invalid expose option", func(def *SystemDefinition) {
+			def.Services[0].Expose = "public"
+		}},
+		{"external without port", func(def *SystemDefinition) {
+			def.Services[4].Type, def.Services[4].Image = "external", "nginx"
+		}},
+		{"external env var", func(def *SystemDefinition) {
+			def.Services[4].Type, def.Services[4].Image, def.Services[4].Port = "external", "nginx", 80
+			def.Services[4].Env = map[string]string{"URL": "{{ url }}"}
+		}},
+		{"unknown zone", func(def *SystemDefinition) {
+			def.Services[0].Zone = "east"
+		}},
+		{"latency to unknown zone", func(def *SystemDefinition) {
+			def.Zones = []Zone{{Name: "east", Latency: map[string]int{"west": 40}}}
+		}},
+		{"negative latency", func(def *SystemDefinition) {
+			def.Zones = []Zone{{Name: "east", Latency: map[string]int{"west": -40}}, {Name: "west"}}
+		}},
+		{"invalid quantity", func(def *SystemDefinition) {
+			def.Services[0].Resources = &Resources{Requests: ResourceAmount{CPU: "lots"}}
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def := loadTestDefinition(t, "simple")
+			test.modify(&def)
+
+			err := validateDefinition(&def)
+			var defErr *DefinitionError
+			if !errors.As(err, &defErr) {
+				t.Errorf("got error %v, want *DefinitionError", err)
+			}
+		})
+	}
+
+	def := loadTestDefinition(t, "simple")
+	if err := validateDefinition(&def); err != nil {
+		t.Errorf("got error %v of valid definition", err)
+	}
+}
+
+func TestContainerNames(t *testing.T) {
+	tests := []struct {
+		svcType  string
+		selector string
+		want     []string
+	}{
+		{"base", ContainerMain, []string{"svc"}},
+		{"base", ContainerAgent, []string{"svc"}},
+		{"base", ContainerDB, nil},
+		{"base", ContainerAll, []string{"svc"}},
+		{"mongodb", ContainerMain, []string{"svc-agent"}},
+		{"mongodb", ContainerDB, []string{"svc-mongodb"}},
+		{"mongodb", ContainerAll, []string{"svc-mongodb", "svc-agent"}},
+		{"broker", ContainerMain, []string{"svc-broker"}},
+		{"broker", ContainerAgent, []string{"svc-agent"}},
+		{"external", ContainerMain, []string{"svc"}},
+		{"base", "sidecar", nil},
+	}
+	for _, test := range tests {
+		t.Run(test.svcType+"/"+test.selector, func(t *testing.T) {
+			if got := ContainerNames(test.svcType, "svc", test.selector); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got containers %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestDeployKeepsSystemOnFailedURLLookup(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Services[0].Expose = exposeNodePort
+	clientset := fake.NewSimpleClientset()
+	clientset.PrependReactor("list", "nodes", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		return true, nil, errors.New("forbidden")
+	})
+
+	result, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(result.URLs) != 0 {
+		t.Errorf("got URLs %v, want none", result.URLs)
+	}
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "delete" {
+			t.Errorf("got %s %s deleted, want nothing deleted", action.GetResource().Resource, action.(k8stesting.DeleteAction).GetName())
+		}
+	}
+	deployments, _ := clientset.AppsV1().Deployments("simple").List(context.Background(), metav1.ListOptions{})
+	if len(deployments.Items) != len(def.Services) {
+		t.Errorf("got %d deployments, want %d", len(deployments.Items), len(def.Services))
+	}
+}
+
+func TestDatabaseCalls(t *testing.T) {
+	def := SystemDefinition{Services: []Service{
+		{Name: "cache", Type: "cache", Calls: []Call{{Name: "db"}, {Name: "logic"}, {Name: "kv"}}},
+		{Name: "db", Type: "mongodb"},
+		{Name: "logic", Type: "base"},
+		{Name: "kv", Type: "redis"},
+	}}
+
+	calls := databaseCalls(def.Services[0], def)
+	if len(calls) != 2 || calls[0].Name != "db" || calls[1].Name != "kv" {
+		t.Errorf("got calls %v, want db and kv", calls)
+	}
+}
+
+func TestAssembleCallsRejectsUnsupportedCalls(t *testing.T) {
+	def := SystemDefinition{Name: "a", Namespace: "a"}
+	for _, call := range []Call{{Name: "b/c", Async: true, Broker: "q"}, {Name: "b/c"}} {
+		if _, err := assembleCalls([]Call{call}, def); err == nil {
+			t.Errorf("got no error of call %+v", call)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Diff compares def with what is actually deployed and prints a semantic diff
+// of services, replicas, images, workload and calls, as well as types, ports
+// and exposure of Kubernetes services. It returns the number of differences
+// found.
+func Diff(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition) (int, error) {
+	if err := validateDefinition(&def); err != nil {
+		return 0, err
+	}
+	units, err := listDeployedUnits(ctx, clientset, def.Namespace, def.Name)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("Comparing %q with deployed resources...\n", def.Name)
+
+	desired := make(map[string]deployedUnit)
+	keys := make([]string, 0)
+	for _, unit := range prepareUnits(def) {
+		desired[unit.key()] = unit
+		keys = append(keys, unit.key())
+	}
+	deployed := make(map[string]deployedUnit)
+	for _, unit := range units {
+		deployed[unit.key()] = unit
+		if _, ok := desired[unit.key()]; !ok {
+			keys = append(keys, unit.key())
+		}
+	}
+	sort.Strings(keys)
+
+	hash := def.hash
+	differences := 0
+	stale := 0
+	for _, key := range keys {
+		want, wanted := desired[key]
+		got, found := deployed[key]
+		switch {
+		case !found:
+			fmt.Printf("- Service %q: missing in cluster.\n", key)
+			differences++
+			continue
+		case !wanted:
+			fmt.Printf("- Service %q: not in definition.\n", key)
+			differences++
+			continue
+		}
+
+		for _, change := range compareUnits(want, got) {
+			fmt.Printf("- Service %q: %s.\n", key, change)
+			differences++
+		}
+		if got.hash != hash {
+			stale++
+		}
+	}
+
+	serviceDifferences, err := diffServices(ctx, clientset, def)
+	if err != nil {
+		return 0, err
+	}
+	differences += serviceDifferences
+
+	if stale > 0 {
+		fmt.Printf("%d services were deployed from another definition.\n", stale)
+	}
+	if differences == 0 {
+		fmt.Printf("No drift detected.\n")
+	} else {
+		fmt.Printf("%d differences found.\n", differences)
+	}
+
+	return differences, nil
+}
+
+// diffServices compares Kubernetes services of def and the paths of its
+// ingress with those deployed, and prints every difference. It returns the
+// number of differences found.
+func diffServices(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition) (int, error) {
+	services, err := clientset.CoreV1().Services(def.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/managed-by=%s,app.kubernetes.io/name=%s", labelManagedBy, def.Name),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	prepared, err := prepareServices(def)
+	if err != nil {
+		return 0, err
+	}
+	desired := make(map[string]*apiv1.Service)
+	names := make([]string, 0)
+	for _, service := range prepared {
+		desired[service.Name] = service
+		names = append(names, service.Name)
+	}
+	deployed := make(map[string]*apiv1.Service)
+	for i, service := range services.Items {
+		deployed[service.Name] = &services.Items[i]
+		if _, ok := desired[service.Name]; !ok {
+			names = append(names, service.Name)
+		}
+	}
+	sort.Strings(names)
+
+	differences := 0
+	for _, name := range names {
+		want, wanted := desired[name]
+		got, found := deployed[name]
+		switch {
+		case !found:
+			fmt.Printf("- Kubernetes service %q: missing in cluster.\n", name)
+			differences++
+			continue
+		case !wanted:
+			fmt.Printf("- Kubernetes service %q: not in definition.\n", name)
+			differences++
+			continue
+		}
+
+		for _, change := range compareServices(want, got) {
+			fmt.Printf("- Kubernetes service %q: %s.\n", name, change)
+			differences++
+		}
+	}
+
+	// Services exposed by ingress are only told apart by ingress paths
+	wantPaths := make(map[string]bool)
+	if ingress := prepareIngress(def); ingress != nil {
+		wantPaths = ingressPaths(ingress)
+	}
+	gotPaths := make(map[string]bool)
+	ingress, err := clientset.NetworkingV1().Ingresses(def.Namespace).Get(ctx, def.Name, metav1.GetOptions{})
+	if err == nil {
+		gotPaths = ingressPaths(ingress)
+	} else if !errors.IsNotFound(err) {
+		return 0, err
+	}
+	paths := make([]string, 0, len(wantPaths)+len(gotPaths))
+	for path := range wantPaths {
+		paths = append(paths, path)
+	}
+	for path := range gotPaths {
+		if !wantPaths[path] {
+			paths = append(paths, path)
+		}
+	}
+	sort.Strings(paths)
+	for _, path := range paths {
+		switch {
+		case wantPaths[path] && !gotPaths[path]:
+			fmt.Printf("- Ingress %q: path %q missing in cluster.\n", def.Name, path)
+			differences++
+		case !wantPaths[path] && gotPaths[path]:
+			fmt.Printf("- Ingress %q: path %q not in definition.\n", def.Name, path)
+			differences++
+		}
+	}
+
+	return differences, nil
+}
+
+func compareServices(want *apiv1.Service, got *apiv1.Service) []string {
+	changes := make([]string, 0)
+
+	// Types and target ports left unset are defaulted by the API server
+	wantType, gotType := want.Spec.Type, got.Spec.Type
+	if wantType == "" {
+		wantType = apiv1.ServiceTypeClusterIP
+	}
+	if gotType == "" {
+		gotType = apiv1.ServiceTypeClusterIP
+	}
+	if wantType != gotType {
+		changes = append(changes, fmt.Sprintf("type changed from %s to %s", wantType, gotType))
+	}
+
+	wantPorts, gotPorts := formatPorts(want.Spec.Ports), formatPorts(got.Spec.Ports)
+	if wantPorts != gotPorts {
+		changes = append(changes, fmt.Sprintf("ports changed from [%s] to [%s]", wantPorts, gotPorts))
+	}
+
+	return changes
+}
+
+// formatPorts formats ports as <name> <port>-><target port>/<protocol>,
+// leaving out node ports allocated by the cluster.
+func formatPorts(ports []apiv1.ServicePort) string {
+	formatted := make([]string, len(ports))
+	for i, port := range ports {
+		targetPort := port.TargetPort.String()
+		if port.TargetPort.IntValue() == 0 && port.TargetPort.StrVal == "" {
+			targetPort = fmt.Sprint(port.Port)
+		}
+		formatted[i] = fmt.Sprintf("%s %d->%s/%s", port.Name, port.Port, targetPort, port.Protocol)
+	}
+	sort.Strings(formatted)
+
+	return strings.Join(formatted, ", ")
+}
+
+func ingressPaths(ingress *networkingv1.Ingress) map[string]bool {
+	paths := make(map[string]bool)
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			paths[path.Path] = true
+		}
+	}
+
+	return paths
+}
+
+func compareUnits(want deployedUnit, got deployedUnit) []string {
+	changes := make([]string, 0)
+	changed := func(field string, from interface{}, to interface{}) {
+		changes = append(changes, fmt.Sprintf("%s changed from %v to %v", field, from, to))
+	}
+
+	if want.svcType != got.svcType {
+		changed("type", want.svcType, got.svcType)
+	}
+	if want.image != got.image {
+		changed("image", want.image, got.image)
+	}
+	if want.replicas != got.replicas {
+		changed("replicas", want.replicas, got.replicas)
+	}
+
+	if want.svcType != "external" && want.svcType != "broker" {
+		wantWorkload := flattenFields("workload", reflect.ValueOf(want.workload))
+		gotWorkload := flattenFields("workload", reflect.ValueOf(got.workload))
+		fields := make([]string, 0, len(wantWorkload))
+		for field := range wantWorkload {
+			fields = append(fields, field)
+		}
+		sort.Strings(fields)
+		for _, field := range fields {
+			if wantWorkload[field] != gotWorkload[field] {
+				changed(field, wantWorkload[field], gotWorkload[field])
+			}
+		}
+	}
+
+	wantCalls, gotCalls := formatCalls(want.calls), formatCalls(got.calls)
+	if wantCalls != gotCalls {
+		changed("calls", "["+wantCalls+"]", "["+gotCalls+"]")
+	}
+
+	return changes
+}
+
+// flattenFields flattens struct v into a map from dotted JSON field paths to
+// formatted values, e.g. "workload.delay.duration".
+func flattenFields(prefix string, v reflect.Value) map[string]string {
+	fields := make(map[string]string)
+	for i := 0; i < v.NumField(); i++ {
+		tag := strings.Split(v.Type().Field(i).Tag.Get("json"), ",")[0]
+		if tag == "" || tag == "-" {
+			continue
+		}
+
+		path := prefix + "." + tag
+		if v.Field(i).Kind() == reflect.Struct {
+			for field, value := range flattenFields(path, v.Field(i)) {
+				fields[field] = value
+			}
+		} else {
+			fields[path] = fmt.Sprint(v.Field(i).Interface())
+		}
+	}
+
+	return fields
+}
+
+func formatCalls(calls []Call) string {
+	formatted := make([]string, len(calls))
+	for i, call := range calls {
+		formatted[i] = call.Name
+		if call.Async {
+			formatted[i] += " (async via " + call.Broker + ")"
+		}
+	}
+	sort.Strings(formatted)
+
+	return strings.Join(formatted, ", ")
+}
@@ -0,0 +1,42 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestDiffDetectsServiceDrift(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	clientset := fake.NewSimpleClientset()
+	if _, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	servicesClient := clientset.CoreV1().Services("simple")
+	service, err := servicesClient.Get(context.Background(), "simple-b", metav1.GetOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	service.Spec.Type = apiv1.ServiceTypeNodePort
+	service.Spec.Ports[0].Port = 8080
+	if _, err := servicesClient.Update(context.Background(), service, metav1.UpdateOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	if err := servicesClient.Delete(context.Background(), "simple-c", metav1.DeleteOptions{}); err != nil {
+		t.Fatal(err)
+	}
+	def.Services[0].Expose = exposeIngress
+
+	// Type & ports of b, missing c, and the ingress path of a
+	differences, err := Diff(context.Background(), clientset, def)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if differences != 4 {
+		t.Errorf("got %d differences, want 4", differences)
+	}
+}
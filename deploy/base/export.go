@@ -0,0 +1,399 @@
+package base
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"sigs.k8s.io/yaml"
+	"sort"
+	"strings"
+	"time"
+)
+
+// Export reconstructs the definitions of every system deployed in namespace
+// from labels, env vars, images and resources of the deployed resources, and
+// from mesh objects read through dynamicClient, unless nil. It also returns
+// warnings about what could not be reconstructed.
+func Export(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace string) ([]SystemDefinition, []string, error) {
+	selector := metav1.ListOptions{
+		LabelSelector: "app.kubernetes.io/managed-by=" + labelManagedBy,
+	}
+	deployments, err := clientset.AppsV1().Deployments(namespace).List(ctx, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+	statefulSets, err := clientset.AppsV1().StatefulSets(namespace).List(ctx, selector)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	systems := make(map[string]bool)
+	for _, deployment := range deployments.Items {
+		systems[deployment.Labels["app.kubernetes.io/name"]] = true
+	}
+	for _, statefulSet := range statefulSets.Items {
+		systems[statefulSet.Labels["app.kubernetes.io/name"]] = true
+	}
+	names := make([]string, 0, len(systems))
+	for name := range systems {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	defs := make([]SystemDefinition, len(names))
+	warnings := make([]string, 0)
+	for i, name := range names {
+		var systemWarnings []string
+		defs[i], systemWarnings, err = exportSystem(ctx, clientset, dynamicClient, namespace, name)
+		if err != nil {
+			return nil, nil, err
+		}
+		warnings = append(warnings, systemWarnings...)
+	}
+
+	return defs, warnings, nil
+}
+
+func exportSystem(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace string, system string) (SystemDefinition, []string, error) {
+	units, err := listDeployedUnits(ctx, clientset, namespace, system)
+	if err != nil {
+		return SystemDefinition{}, nil, err
+	}
+	sort.SliceStable(units, func(i, j int) bool {
+		return units[i].id < units[j].id
+	})
+
+	def := SystemDefinition{
+		Name:      system,
+		Namespace: namespace,
+		Replicas:  0,
+	}
+	// Versions of a service split the replicas of the system between them
+	totals := make(map[string]int32)
+	versionGCDs := make(map[string]int32)
+	for _, unit := range units {
+		totals[unit.service] += unit.replicas
+		versionGCDs[unit.service] = gcd(versionGCDs[unit.service], unit.replicas)
+	}
+	for _, total := range totals {
+		def.Replicas = gcd(def.Replicas, total)
+	}
+	for _, unit := range units {
+		def.LiveWorkload = def.LiveWorkload || unit.live
+		if unit.zone != "" && def.zone(unit.zone) == nil {
+			def.Zones = append(def.Zones, Zone{
+				Name:     unit.zone,
+				Topology: unit.topology,
+			})
+		}
+	}
+
+	// Units of the same service are versions of it
+	warnings := make([]string, 0)
+	warned := make(map[string]bool)
+	for _, unit := range units {
+		svc := def.service(unit.service)
+		if svc == nil {
+			def.Services = append(def.Services, exportService(unit))
+			svc = &def.Services[len(def.Services)-1]
+		}
+
+		if totals[unit.service] != def.Replicas && !warned[unit.service] {
+			warnings = append(warnings, fmt.Sprintf("service %q of %q runs %d replicas instead of %d, which could not be exported", unit.service, system, totals[unit.service], def.Replicas))
+			warned[unit.service] = true
+		}
+		if unit.version == "" {
+			continue
+		}
+
+		workload := unit.workload
+		version := Version{
+			Name:     unit.version,
+			Workload: &workload,
+		}
+		if versionGCDs[unit.service] > 0 {
+			// Weights are unknown once every version is scaled to zero
+			version.Weight = int32Ptr(unit.replicas / versionGCDs[unit.service])
+		}
+		if unit.image != defaultImage(unit.svcType) {
+			version.Image = unit.image
+		}
+		svc.Versions = append(svc.Versions, version)
+	}
+	for i := range def.Services {
+		if len(def.Services[i].Versions) > 0 {
+			// Workload & image are kept by every version instead
+			def.Services[i].Workload = Workload{}
+			def.Services[i].Image = ""
+		}
+	}
+
+	if err := exportExposure(ctx, clientset, &def); err != nil {
+		return SystemDefinition{}, nil, err
+	}
+	if err := exportZoneLatency(ctx, clientset, &def, units); err != nil {
+		return SystemDefinition{}, nil, err
+	}
+	meshWarnings, err := exportMesh(ctx, clientset, dynamicClient, &def)
+	if err != nil {
+		return SystemDefinition{}, nil, err
+	}
+	return def, append(warnings, meshWarnings...), nil
+}
+
+func exportService(unit deployedUnit) Service {
+	svc := Service{
+		Name:      unit.service,
+		Type:      unit.svcType,
+		Workload:  unit.workload,
+		Calls:     unit.calls,
+		Resources: unit.resources,
+		Node:      unit.node,
+		Zone:      unit.zone,
+		Storage:   unit.storage,
+		Port:      unit.port,
+		Env:       unit.env,
+		Command:   unit.command,
+		Args:      unit.args,
+	}
+	if unit.image != defaultImage(unit.svcType) {
+		svc.Image = unit.image
+	}
+
+	return svc
+}
+
+func exportExposure(ctx context.Context, clientset kubernetes.Interface, def *SystemDefinition) error {
+	services, err := clientset.CoreV1().Services(def.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/managed-by=%s,app.kubernetes.io/name=%s", labelManagedBy, def.Name),
+	})
+	if err != nil {
+		return err
+	}
+	for _, service := range services.Items {
+		svc := def.service(strings.TrimPrefix(service.Name, def.Name+"-"))
+		if svc == nil {
+			continue
+		}
+
+		if svc.Type == "external" && len(service.Spec.Ports) > 0 && service.Spec.Ports[0].Name != protocolTCP {
+			svc.Protocol = service.Spec.Ports[0].Name
+		}
+		switch service.Spec.Type {
+		case apiv1.ServiceTypeNodePort:
+			svc.Expose = exposeNodePort
+		case apiv1.ServiceTypeLoadBalancer:
+			svc.Expose = exposeLoadBalancer
+		}
+	}
+
+	ingress, err := clientset.NetworkingV1().Ingresses(def.Namespace).Get(ctx, def.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	if ingress.Spec.IngressClassName != nil {
+		def.IngressClass = *ingress.Spec.IngressClassName
+	}
+	for _, rule := range ingress.Spec.Rules {
+		if rule.HTTP == nil {
+			continue
+		}
+		for _, path := range rule.HTTP.Paths {
+			if svc := def.service(strings.TrimPrefix(path.Path, "/")); svc != nil {
+				svc.Expose = exposeIngress
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportZoneLatency reconstructs the latency between zones from the delays of
+// calls to other zones. Latency between zones not calling each other is not
+// applied, so it could not be exported.
+func exportZoneLatency(ctx context.Context, clientset kubernetes.Interface, def *SystemDefinition, units []deployedUnit) error {
+	delayed := false
+	for _, unit := range units {
+		delayed = delayed || len(unit.delays) > 0
+	}
+	if !delayed {
+		return nil
+	}
+
+	services, err := clientset.CoreV1().Services(def.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/managed-by=%s,app.kubernetes.io/name=%s", labelManagedBy, def.Name),
+	})
+	if err != nil {
+		return err
+	}
+	callees := make(map[string]string)
+	for _, service := range services.Items {
+		callees[service.Spec.ClusterIP] = strings.TrimPrefix(service.Name, def.Name+"-")
+	}
+
+	for _, unit := range units {
+		for ip, latency := range unit.delays {
+			callee := def.service(callees[ip])
+			if unit.zone == "" || callee == nil || callee.Zone == "" || def.latency(unit.zone, callee.Zone) == latency {
+				continue
+			}
+
+			zone := def.zone(unit.zone)
+			if zone.Latency == nil {
+				zone.Latency = make(map[string]int)
+			}
+			zone.Latency[callee.Zone] = latency
+		}
+	}
+
+	return nil
+}
+
+// exportMesh reconstructs the mesh of def from its namespace, and timeout &
+// retries of calls from istio virtual services. It returns warnings about
+// what could not be read.
+func exportMesh(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, def *SystemDefinition) ([]string, error) {
+	namespace, err := clientset.CoreV1().Namespaces().Get(ctx, def.Namespace, metav1.GetOptions{})
+	if err != nil {
+		// Namespaces may not be readable with namespaced permissions
+		return []string{fmt.Sprintf("mesh of %q could not be exported: %v", def.Name, err)}, nil
+	}
+	switch {
+	case namespace.Labels["istio-injection"] == "enabled":
+		def.Mesh = meshIstio
+	case namespace.Annotations["linkerd.io/inject"] == "enabled":
+		def.Mesh = meshLinkerd
+	}
+	if def.Mesh != meshIstio {
+		return nil, nil
+	}
+	if dynamicClient == nil {
+		return []string{fmt.Sprintf("timeout & retries of calls of %q could not be exported without reading virtual services", def.Name)}, nil
+	}
+
+	services, err := dynamicClient.Resource(virtualServiceResource).Namespace(def.Namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/managed-by=%s,app.kubernetes.io/name=%s", labelManagedBy, def.Name),
+	})
+	if errors.IsNotFound(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	for _, service := range services.Items {
+		callee := strings.TrimPrefix(service.GetName(), def.Name+"-")
+		rules, _, _ := unstructured.NestedSlice(service.Object, "spec", "http")
+		for _, rule := range rules {
+			rule, ok := rule.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			matches, _, _ := unstructured.NestedSlice(rule, "match")
+			if len(matches) == 0 {
+				continue
+			}
+			match, ok := matches[0].(map[string]interface{})
+			if !ok {
+				continue
+			}
+			caller, _, _ := unstructured.NestedString(match, "sourceLabels", benServiceName)
+			svc := def.service(caller)
+			if svc == nil {
+				continue
+			}
+
+			timeout, _, _ := unstructured.NestedString(rule, "timeout")
+			retries, _, _ := unstructured.NestedInt64(rule, "retries", "attempts")
+			for i := range svc.Calls {
+				if svc.Calls[i].Name != callee || svc.Calls[i].Async {
+					continue
+				}
+				if d, err := time.ParseDuration(timeout); err == nil {
+					svc.Calls[i].Timeout = int(d.Milliseconds())
+				}
+				svc.Calls[i].Retries = int(retries)
+			}
+		}
+	}
+
+	return nil, nil
+}
+
+// MarshalDefinition renders def in YAML, omitting every unset field.
+func MarshalDefinition(def SystemDefinition) ([]byte, error) {
+	defJSON, err := json.Marshal(def)
+	if err != nil {
+		return nil, err
+	}
+
+	var tree interface{}
+	if err := json.Unmarshal(defJSON, &tree); err != nil {
+		return nil, err
+	}
+
+	// Systems scaled to zero keep their replica count
+	pruned, ok := pruneUnset(tree).(map[string]interface{})
+	if !ok {
+		pruned = make(map[string]interface{})
+	}
+	pruned["replicas"] = def.Replicas
+
+	return yaml.Marshal(pruned)
+}
+
+// pruneUnset removes zero values, empty lists and empty objects from tree.
+func pruneUnset(tree interface{}) interface{} {
+	switch node := tree.(type) {
+	case map[string]interface{}:
+		for key, value := range node {
+			if key == "weight" && value != nil {
+				// Unset weights default to 1, unlike those set to zero
+				continue
+			}
+			if pruned := pruneUnset(value); pruned == nil {
+				delete(node, key)
+			} else {
+				node[key] = pruned
+			}
+		}
+		if len(node) == 0 {
+			return nil
+		}
+	case []interface{}:
+		if len(node) == 0 {
+			return nil
+		}
+		for i, value := range node {
+			node[i] = pruneUnset(value)
+		}
+	case string:
+		if node == "" {
+			return nil
+		}
+	case float64:
+		if node == 0 {
+			return nil
+		}
+	case bool:
+		if !node {
+			return nil
+		}
+	}
+
+	return tree
+}
+
+func gcd(a int32, b int32) int32 {
+	for b != 0 {
+		a, b = b, a%b
+	}
+
+	return a
+}
@@ -0,0 +1,132 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+	k8stesting "k8s.io/client-go/testing"
+)
+
+func TestGCD(t *testing.T) {
+	tests := []struct {
+		a, b, want int32
+	}{
+		{0, 0, 0},
+		{0, 3, 3},
+		{3, 0, 3},
+		{4, 6, 2},
+		{9, 3, 3},
+		{7, 5, 1},
+	}
+	for _, test := range tests {
+		if got := gcd(test.a, test.b); got != test.want {
+			t.Errorf("gcd(%d, %d) = %d, want %d", test.a, test.b, got, test.want)
+		}
+	}
+}
+
+func TestExportScaledToZero(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Services[0].Versions = []Version{{Name: "v1"}, {Name: "v2"}}
+	clientset := fake.NewSimpleClientset()
+	if _, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000}); err != nil {
+		t.Fatal(err)
+	}
+
+	deploymentsClient := clientset.AppsV1().Deployments("simple")
+	deployments, err := deploymentsClient.List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, deployment := range deployments.Items {
+		deployment.Spec.Replicas = int32Ptr(0)
+		if _, err := deploymentsClient.Update(context.Background(), &deployment, metav1.UpdateOptions{}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	defs, warnings, err := Export(context.Background(), clientset, nil, "simple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || len(warnings) != 0 {
+		t.Fatalf("got %d definitions & warnings %v, want 1 definition without warnings", len(defs), warnings)
+	}
+	if defs[0].Replicas != 0 {
+		t.Errorf("got replicas %d, want 0", defs[0].Replicas)
+	}
+	for _, version := range defs[0].service("a").Versions {
+		if version.Weight != nil {
+			t.Errorf("got weight %d of version %q, want none", *version.Weight, version.Name)
+		}
+	}
+
+	defYAML, err := MarshalDefinition(defs[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(string(defYAML), "replicas: 0") {
+		t.Errorf("got definition without replicas: 0:\n%s", defYAML)
+	}
+}
+
+func TestExportRoundTrip(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Mesh = meshIstio
+	def.Zones = []Zone{{Name: "east", Latency: map[string]int{"west": 40}}, {Name: "west"}}
+	def.Services[0].Zone = "east"
+	def.Services[0].Calls = []Call{{Name: "b", Timeout: 500, Retries: 2}, {Name: "c"}}
+	def.Services[1].Zone = "west"
+	clientset := fake.NewSimpleClientset()
+	// Cluster IPs are assigned by the API server, which the fake one is not
+	clusterIPs := 0
+	clientset.PrependReactor("create", "services", func(action k8stesting.Action) (bool, runtime.Object, error) {
+		service := action.(k8stesting.CreateAction).GetObject().(*apiv1.Service)
+		clusterIPs++
+		service.Spec.ClusterIP = fmt.Sprintf("10.96.0.%d", clusterIPs)
+		return false, nil, nil
+	})
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		virtualServiceResource:  "VirtualServiceList",
+		destinationRuleResource: "DestinationRuleList",
+	})
+	if _, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000, Dynamic: dynamicClient}); err != nil {
+		t.Fatal(err)
+	}
+
+	defs, warnings, err := Export(context.Background(), clientset, dynamicClient, "simple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(defs) != 1 || len(warnings) != 0 {
+		t.Fatalf("got %d definitions & warnings %v, want 1 definition without warnings", len(defs), warnings)
+	}
+	exported := defs[0]
+	if exported.Mesh != meshIstio {
+		t.Errorf("got mesh %q, want %q", exported.Mesh, meshIstio)
+	}
+	if latency := exported.latency("east", "west"); latency != 40 {
+		t.Errorf("got latency %d between east & west, want 40", latency)
+	}
+	if calls := exported.service("a").Calls; !reflect.DeepEqual(calls, def.Services[0].Calls) {
+		t.Errorf("got calls %+v, want %+v", calls, def.Services[0].Calls)
+	}
+
+	// Warnings tell what could not be read
+	_, warnings, err = Export(context.Background(), clientset, nil, "simple")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(warnings) != 1 {
+		t.Errorf("got warnings %v without dynamic client, want 1", warnings)
+	}
+}
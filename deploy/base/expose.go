@@ -0,0 +1,298 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	networkingv1 "k8s.io/api/networking/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/wait"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+	"time"
+)
+
+const (
+	exposeNone         = "none"
+	exposeNodePort     = "nodeport"
+	exposeLoadBalancer = "loadbalancer"
+	exposeIngress      = "ingress"
+)
+
+const addressPollInterval = 2 * time.Second
+const addressPollTimeout = 2 * time.Minute
+
+// exposure returns how a service is exposed outside the cluster. Services
+// without explicit exposure fall back to the system exposure if they are entry
+// services, i.e. services not called by any other service.
+func (def SystemDefinition) exposure(svc Service) string {
+	if svc.Expose != "" {
+		return strings.ToLower(svc.Expose)
+	}
+	if def.Expose == "" || !def.isEntry(svc) {
+		return exposeNone
+	}
+
+	return strings.ToLower(def.Expose)
+}
+
+// isEntry reports whether svc serves requests from outside the system. Brokers
+// are never called directly, but only carry async calls between services.
+func (def SystemDefinition) isEntry(svc Service) bool {
+	if svc.Type == "broker" {
+		return false
+	}
+	for _, caller := range def.Services {
+		for _, call := range caller.Calls {
+			if call.Name == svc.Name {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// validateExposure checks def and every service of it are exposed by one of
+// the supported options.
+func validateExposure(def SystemDefinition) error {
+	exposures := []string{strings.ToLower(def.Expose)}
+	for _, svc := range def.Services {
+		exposures = append(exposures, def.exposure(svc))
+	}
+
+	for _, exposure := range exposures {
+		switch exposure {
+		case "", exposeNone, exposeNodePort, exposeLoadBalancer, exposeIngress:
+		default:
+			return fmt.Errorf("invalid expose option %q is specified.\nSupported options: none, nodeport, loadbalancer, ingress", exposure)
+		}
+	}
+
+	return nil
+}
+
+func serviceType(exposure string) (apiv1.ServiceType, error) {
+	switch exposure {
+	case exposeNodePort:
+		return apiv1.ServiceTypeNodePort, nil
+	case exposeLoadBalancer:
+		return apiv1.ServiceTypeLoadBalancer, nil
+	case exposeNone, exposeIngress:
+		return apiv1.ServiceTypeClusterIP, nil
+	default:
+		return "", fmt.Errorf("invalid expose option %q is specified.\nSupported options: none, nodeport, loadbalancer, ingress", exposure)
+	}
+}
+
+// prepareIngress returns an ingress routing path /<service> to every service
+// exposed by ingress, or nil if there's no such service. Paths are not
+// rewritten, as rewriting is specific to ingress controllers, so services
+// receive requests under /<service>.
+func prepareIngress(def SystemDefinition) *networkingv1.Ingress {
+	pathType := networkingv1.PathTypePrefix
+	paths := make([]networkingv1.HTTPIngressPath, 0)
+	for _, svc := range def.Services {
+		if def.exposure(svc) != exposeIngress {
+			continue
+		}
+
+		paths = append(paths, networkingv1.HTTPIngressPath{
+			Path:     "/" + svc.Name,
+			PathType: &pathType,
+			Backend: networkingv1.IngressBackend{
+				Service: &networkingv1.IngressServiceBackend{
+					Name: def.Name + "-" + svc.Name,
+					Port: networkingv1.ServiceBackendPort{
+						Number: int32(svc.exposedPort()),
+					},
+				},
+			},
+		})
+	}
+	if len(paths) == 0 {
+		return nil
+	}
+
+	ingress := &networkingv1.Ingress{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      def.Name,
+			Namespace: def.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       def.Name,
+				"app.kubernetes.io/managed-by": labelManagedBy,
+			},
+		},
+		Spec: networkingv1.IngressSpec{
+			Rules: []networkingv1.IngressRule{
+				{
+					IngressRuleValue: networkingv1.IngressRuleValue{
+						HTTP: &networkingv1.HTTPIngressRuleValue{
+							Paths: paths,
+						},
+					},
+				},
+			},
+		},
+	}
+	if def.IngressClass != "" {
+		ingress.Spec.IngressClassName = &def.IngressClass
+	}
+
+	return ingress
+}
+
+// createIngressTasks returns the task creating ingress of def if any, which
+// stores created or already existing ingress in result.
+func createIngressTasks(clientset kubernetes.Interface, def SystemDefinition, result **networkingv1.Ingress) []task {
+	ingress := prepareIngress(def)
+	if ingress == nil {
+		return nil
+	}
+
+	ingressClient := clientset.NetworkingV1().Ingresses(def.Namespace)
+	return []task{
+		{
+			kind: "ingress",
+			name: ingress.Name,
+			create: func(ctx context.Context) error {
+				created, err := ingressClient.Create(ctx, ingress, metav1.CreateOptions{})
+				if errors.IsAlreadyExists(err) {
+					created = ingress
+				}
+				*result = created
+				return err
+			},
+			delete: func(ctx context.Context) error {
+				return ingressClient.Delete(ctx, ingress.Name, deleteOptions())
+			},
+		},
+	}
+}
+
+// exposedURLs prints and returns the URLs exposed services are reachable at by
+// service name, waiting for load balancers to be provisioned if necessary.
+// Addresses are awaited for addressPollTimeout at most altogether.
+func exposedURLs(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition, services []*apiv1.Service, ingress *networkingv1.Ingress) (map[string]string, error) {
+	ctx, cancel := context.WithTimeout(ctx, addressPollTimeout)
+	defer cancel()
+
+	urls := make(map[string]string)
+	ordered := make([]string, 0)
+
+	// Services exposed by ingress share its address, which is polled once
+	var ingressAddress string
+	if ingress != nil {
+		var err error
+		ingressAddress, err = pollAddress(ctx, func(ctx context.Context) (apiv1.LoadBalancerStatus, error) {
+			result, err := clientset.NetworkingV1().Ingresses(ingress.Namespace).Get(ctx, ingress.Name, metav1.GetOptions{})
+			if err != nil {
+				return apiv1.LoadBalancerStatus{}, err
+			}
+
+			return result.Status.LoadBalancer, nil
+		})
+		if err != nil {
+			return urls, err
+		}
+	}
+
+	for i, svc := range def.Services {
+		var url string
+		var err error
+		switch def.exposure(svc) {
+		case exposeNodePort:
+			url, err = nodePortURL(ctx, clientset, services[i])
+		case exposeLoadBalancer:
+			url, err = loadBalancerURL(ctx, clientset, services[i])
+		case exposeIngress:
+			if ingressAddress != "" {
+				url = ingressAddress + "/" + svc.Name
+			}
+		default:
+			continue
+		}
+		if err != nil {
+			return urls, err
+		}
+
+		if url == "" {
+			fmt.Printf("- Service %q: address still pending.\n", svc.Name)
+			continue
+		}
+		fmt.Printf("- Service %q: %s\n", svc.Name, url)
+		urls[svc.Name] = url
+		ordered = append(ordered, url)
+	}
+
+	if len(ordered) > 0 {
+		fmt.Printf("Exposed URLs of %q:\n%q\n", def.Name, strings.Join(ordered, " "))
+	}
+
+	return urls, nil
+}
+
+func nodePortURL(ctx context.Context, clientset kubernetes.Interface, service *apiv1.Service) (string, error) {
+	nodes, err := clientset.CoreV1().Nodes().List(ctx, metav1.ListOptions{})
+	if err != nil {
+		return "", err
+	}
+
+	// Prefer external addresses over internal ones
+	for _, addressType := range []apiv1.NodeAddressType{apiv1.NodeExternalIP, apiv1.NodeInternalIP} {
+		for _, node := range nodes.Items {
+			for _, address := range node.Status.Addresses {
+				if address.Type == addressType {
+					return fmt.Sprintf("http://%s:%d", address.Address, service.Spec.Ports[0].NodePort), nil
+				}
+			}
+		}
+	}
+
+	return "", nil
+}
+
+func loadBalancerURL(ctx context.Context, clientset kubernetes.Interface, service *apiv1.Service) (string, error) {
+	return pollAddress(ctx, func(ctx context.Context) (apiv1.LoadBalancerStatus, error) {
+		result, err := clientset.CoreV1().Services(service.Namespace).Get(ctx, service.Name, metav1.GetOptions{})
+		if err != nil {
+			return apiv1.LoadBalancerStatus{}, err
+		}
+
+		return result.Status.LoadBalancer, nil
+	})
+}
+
+// pollAddress polls the load balancer status until an address is assigned. An
+// address not assigned before ctx is done is not an error, but left empty.
+func pollAddress(ctx context.Context, status func(ctx context.Context) (apiv1.LoadBalancerStatus, error)) (string, error) {
+	var url string
+	err := wait.PollImmediateUntil(addressPollInterval, func() (bool, error) {
+		result, err := status(ctx)
+		if err != nil {
+			return false, err
+		}
+
+		url = loadBalancerAddress(result)
+		return url != "", nil
+	}, ctx.Done())
+	if err == wait.ErrWaitTimeout {
+		return "", nil
+	}
+
+	return url, err
+}
+
+func loadBalancerAddress(status apiv1.LoadBalancerStatus) string {
+	for _, ingress := range status.Ingress {
+		if ingress.Hostname != "" {
+			return "http://" + ingress.Hostname
+		}
+		if ingress.IP != "" {
+			return "http://" + ingress.IP
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,75 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestExposedURLsPollIngressOnce(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Services[1].Expose = exposeIngress
+	def.Services[2].Expose = exposeIngress
+	ingress := prepareIngress(def)
+	ingress.Status.LoadBalancer.Ingress = []apiv1.LoadBalancerIngress{{IP: "10.0.0.1"}}
+	clientset := fake.NewSimpleClientset(ingress)
+	services, err := prepareServices(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	urls, err := exposedURLs(context.Background(), clientset, def, services, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if urls["b"] != "http://10.0.0.1/b" || urls["c"] != "http://10.0.0.1/c" {
+		t.Errorf("got URLs %v, want b & c behind http://10.0.0.1", urls)
+	}
+
+	gets := 0
+	for _, action := range clientset.Actions() {
+		if action.GetVerb() == "get" && action.GetResource().Resource == "ingresses" {
+			gets++
+		}
+	}
+	if gets != 1 {
+		t.Errorf("got ingress polled %d times, want once", gets)
+	}
+}
+
+func TestExposedURLsStopPollingWithContext(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Services[1].Expose = exposeIngress
+	ingress := prepareIngress(def)
+	clientset := fake.NewSimpleClientset(ingress)
+	services, err := prepareServices(def)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	urls, err := exposedURLs(ctx, clientset, def, services, ingress)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(urls) != 0 {
+		t.Errorf("got URLs %v of pending ingress, want none", urls)
+	}
+}
+
+func TestExposureSkipsBrokers(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Expose = exposeNodePort
+	def.Services[4].Type = "broker"
+	def.Services[2].Calls = []Call{{Name: "d", Async: true, Broker: "e"}}
+
+	if exposure := def.exposure(def.Services[0]); exposure != exposeNodePort {
+		t.Errorf("got exposure %q of entry service, want %q", exposure, exposeNodePort)
+	}
+	if exposure := def.exposure(def.Services[4]); exposure != exposeNone {
+		t.Errorf("got exposure %q of broker, want %q", exposure, exposeNone)
+	}
+}
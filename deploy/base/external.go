@@ -0,0 +1,117 @@
+package base
+
+import (
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"sort"
+	"strings"
+	"text/template"
+)
+
+// listeningPort returns the container port traffic to svc is forwarded to.
+func (svc Service) listeningPort() int {
+	switch svc.Type {
+	case "external":
+		return svc.Port
+	case "broker":
+		return brokerListeningPort
+	default:
+		return baseListeningPort
+	}
+}
+
+// exposedPort returns the port svc is reachable at by other services.
+func (svc Service) exposedPort() int {
+	if svc.Type == "broker" {
+		return brokerListeningPort
+	}
+
+	return baseExposedPort
+}
+
+// prepareExternalContainer returns the container running an arbitrary image
+// as a member of the simulated system. Env var values are templates in which
+// {{ url "name" }} and {{ host "name" }} resolve to simulated services, so that
+// the external service could call back into the system.
+func prepareExternalContainer(svc Service, def SystemDefinition) (apiv1.Container, error) {
+	envs, err := prepareExternalEnvVar(svc, def.Name)
+	if err != nil {
+		return apiv1.Container{}, err
+	}
+
+	container := apiv1.Container{
+		Name:    svc.Name,
+		Image:   svc.Image,
+		Command: svc.Command,
+		Args:    svc.Args,
+		Ports: []apiv1.ContainerPort{
+			{
+				ContainerPort: int32(svc.Port),
+				Protocol:      apiv1.ProtocolTCP,
+			},
+		},
+		Env: envs,
+	}
+	svc.Resources.applyTo(&container.Resources)
+
+	return container, nil
+}
+
+// validateExternal checks every version of external services of def has an
+// image to run, a port to listen on and env vars rendering successfully.
+func validateExternal(def SystemDefinition) error {
+	for _, svc := range def.Services {
+		if svc.Type != "external" {
+			continue
+		}
+
+		for _, version := range svc.versions() {
+			svc := svc.withVersion(version)
+			if svc.Image == "" || svc.Port == 0 {
+				return fmt.Errorf("external service %q must specify both image and port", svc.Name)
+			}
+			if _, err := prepareExternalEnvVar(svc, def.Name); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+func prepareExternalEnvVar(svc Service, sysName string) ([]apiv1.EnvVar, error) {
+	funcs := template.FuncMap{
+		"host": func(name string) string {
+			return sysName + "-" + name
+		},
+		"url": func(name string) string {
+			return fmt.Sprintf("http://%s-%s", sysName, name)
+		},
+	}
+
+	// Sort env vars by name to keep pod template stable across deployments
+	names := make([]string, 0, len(svc.Env))
+	for name := range svc.Env {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	envs := make([]apiv1.EnvVar, len(names))
+	for i, name := range names {
+		tmpl, err := template.New(name).Funcs(funcs).Parse(svc.Env[name])
+		if err != nil {
+			return nil, fmt.Errorf("invalid env var %q of service %q: %v", name, svc.Name, err)
+		}
+
+		var value strings.Builder
+		if err := tmpl.Execute(&value, nil); err != nil {
+			return nil, fmt.Errorf("invalid env var %q of service %q: %v", name, svc.Name, err)
+		}
+		envs[i] = apiv1.EnvVar{
+			Name:  name,
+			Value: value.String(),
+		}
+	}
+
+	return envs, nil
+}
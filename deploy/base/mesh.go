@@ -0,0 +1,359 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/apis/meta/v1/unstructured"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	"k8s.io/client-go/dynamic"
+	"strconv"
+)
+
+const (
+	meshNone    = ""
+	meshIstio   = "istio"
+	meshLinkerd = "linkerd"
+)
+
+// Protocols of service ports, also used as port names for meshes to detect
+// the protocol, as service names exceed the 15 characters limit of port names.
+const (
+	protocolHTTP  = "http"
+	protocolHTTP2 = "http2"
+	protocolGRPC  = "grpc"
+	protocolTCP   = "tcp"
+)
+
+const istioRetryOn = "5xx,gateway-error,connect-failure,reset"
+
+var (
+	virtualServiceResource  = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "virtualservices"}
+	destinationRuleResource = schema.GroupVersionResource{Group: "networking.istio.io", Version: "v1beta1", Resource: "destinationrules"}
+)
+
+// validateMesh checks the mesh of def is supported, and so are protocols of
+// services and mesh timeouts & retries of calls, which only istio applies.
+func validateMesh(def SystemDefinition) error {
+	switch def.Mesh {
+	case meshNone, meshIstio, meshLinkerd:
+	default:
+		return fmt.Errorf("invalid mesh option %q is specified.\nSupported options: istio, linkerd", def.Mesh)
+	}
+
+	for _, svc := range def.Services {
+		switch {
+		case svc.Protocol == "":
+		case svc.Type != "external":
+			return fmt.Errorf("protocol of service %q is only supported by external services", svc.Name)
+		case svc.Protocol != protocolHTTP && svc.Protocol != protocolHTTP2 && svc.Protocol != protocolGRPC && svc.Protocol != protocolTCP:
+			return fmt.Errorf("invalid protocol %q of service %q is specified.\nSupported options: http, http2, grpc, tcp", svc.Protocol, svc.Name)
+		}
+
+		for _, call := range svc.Calls {
+			if call.Timeout <= 0 && call.Retries <= 0 {
+				continue
+			}
+
+			callee := def.service(call.Name)
+			switch {
+			case def.Mesh != meshIstio:
+				return fmt.Errorf("timeout & retries of call %q of service %q require the istio mesh", call.Name, svc.Name)
+			case call.Async || callee == nil:
+				return fmt.Errorf("timeout & retries of call %q of service %q only apply to synchronous calls within the system", call.Name, svc.Name)
+			case callee.protocol() == protocolTCP:
+				return fmt.Errorf("timeout & retries of call %q of service %q do not apply to TCP services", call.Name, svc.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// protocol returns the application protocol of traffic to svc. External
+// services run arbitrary images, so their traffic is opaque unless set.
+func (svc Service) protocol() string {
+	switch svc.Type {
+	case "broker":
+		return protocolTCP
+	case "external":
+		if svc.Protocol == "" {
+			return protocolTCP
+		}
+		return svc.Protocol
+	default:
+		return protocolHTTP
+	}
+}
+
+// prepareNamespaceMeta returns labels & annotations of the namespace of def,
+// which enable sidecar injection of its mesh.
+func prepareNamespaceMeta(def SystemDefinition) (map[string]string, map[string]string) {
+	switch def.Mesh {
+	case meshIstio:
+		return map[string]string{"istio-injection": "enabled"}, nil
+	case meshLinkerd:
+		annotations := map[string]string{"linkerd.io/inject": "enabled"}
+		for _, svc := range def.Services {
+			if svc.Type == "broker" {
+				// Brokers speak first, which linkerd could not detect
+				annotations["config.linkerd.io/opaque-ports"] = strconv.Itoa(brokerListeningPort)
+			}
+		}
+		return nil, annotations
+	default:
+		return nil, nil
+	}
+}
+
+// meshRoute is the route of calls from a caller with its own timeout & retries.
+type meshRoute struct {
+	caller  string
+	timeout int
+	retries int
+}
+
+// prepareMeshRoutes returns the routes of synchronous calls to every service
+// with timeout or retries in the system, by callee name.
+func prepareMeshRoutes(def SystemDefinition) map[string][]meshRoute {
+	routes := make(map[string][]meshRoute)
+	for _, caller := range def.Services {
+		for _, call := range caller.Calls {
+			if call.Async || def.service(call.Name) == nil {
+				// Only calls within the system are routed by it
+				continue
+			}
+			if call.Timeout <= 0 && call.Retries <= 0 {
+				continue
+			}
+
+			routes[call.Name] = append(routes[call.Name], meshRoute{
+				caller:  caller.Name,
+				timeout: call.Timeout,
+				retries: call.Retries,
+			})
+		}
+	}
+
+	return routes
+}
+
+// prepareVirtualServices returns istio virtual services of services that are
+// called with timeout or retries, or split into versions by weight.
+func prepareVirtualServices(def SystemDefinition) []*unstructured.Unstructured {
+	if def.Mesh != meshIstio {
+		return nil
+	}
+
+	routes := prepareMeshRoutes(def)
+	services := make([]*unstructured.Unstructured, 0)
+	for _, svc := range def.Services {
+		if len(routes[svc.Name]) == 0 && len(svc.Versions) == 0 {
+			continue
+		}
+
+		host := def.Name + "-" + svc.Name
+		destinations := prepareMeshDestinations(svc, host)
+		if svc.protocol() == protocolTCP {
+			// TCP services are only split into versions
+			services = append(services, prepareMeshObject(def, "VirtualService", host, map[string]interface{}{
+				"hosts": []interface{}{host},
+				"tcp": []interface{}{
+					map[string]interface{}{"route": destinations},
+				},
+			}))
+			continue
+		}
+		http := make([]interface{}, 0, len(routes[svc.Name])+1)
+		for _, route := range routes[svc.Name] {
+			rule := map[string]interface{}{
+				"match": []interface{}{
+					map[string]interface{}{
+						"sourceLabels": map[string]interface{}{
+							"app.kubernetes.io/name": def.Name,
+							benServiceName:           route.caller,
+						},
+					},
+				},
+				"route": destinations,
+			}
+			if route.timeout > 0 {
+				rule["timeout"] = fmt.Sprintf("%dms", route.timeout)
+			}
+			if route.retries > 0 {
+				rule["retries"] = map[string]interface{}{
+					"attempts": int64(route.retries),
+					"retryOn":  istioRetryOn,
+				}
+			}
+			http = append(http, rule)
+		}
+		http = append(http, map[string]interface{}{
+			"route": destinations,
+		})
+
+		services = append(services, prepareMeshObject(def, "VirtualService", host, map[string]interface{}{
+			"hosts": []interface{}{host},
+			"http":  http,
+		}))
+	}
+
+	return services
+}
+
+// prepareMeshDestinations splits traffic to svc over its versions by weight,
+// which istio requires to sum up to 100.
+func prepareMeshDestinations(svc Service, host string) []interface{} {
+	if len(svc.Versions) == 0 {
+		return []interface{}{
+			map[string]interface{}{
+				"destination": map[string]interface{}{"host": host},
+			},
+		}
+	}
+
+	total := int32(0)
+	for _, version := range svc.Versions {
+		total += version.weight()
+	}
+	destinations := make([]interface{}, len(svc.Versions))
+	remaining := int64(100)
+	for i := len(svc.Versions) - 1; i >= 0; i-- {
+		weight := int64(svc.Versions[i].weight() * 100 / total)
+		if i == 0 {
+			weight = remaining
+		}
+		remaining -= weight
+		destinations[i] = map[string]interface{}{
+			"destination": map[string]interface{}{
+				"host":   host,
+				"subset": svc.Versions[i].Name,
+			},
+			"weight": weight,
+		}
+	}
+
+	return destinations
+}
+
+// prepareDestinationRules returns istio destination rules defining a subset
+// for every version of services.
+func prepareDestinationRules(def SystemDefinition) []*unstructured.Unstructured {
+	if def.Mesh != meshIstio {
+		return nil
+	}
+
+	rules := make([]*unstructured.Unstructured, 0)
+	for _, svc := range def.Services {
+		if len(svc.Versions) == 0 {
+			continue
+		}
+
+		host := def.Name + "-" + svc.Name
+		subsets := make([]interface{}, len(svc.Versions))
+		for i, version := range svc.Versions {
+			subsets[i] = map[string]interface{}{
+				"name": version.Name,
+				"labels": map[string]interface{}{
+					benServiceVersion: version.Name,
+				},
+			}
+		}
+		rules = append(rules, prepareMeshObject(def, "DestinationRule", host, map[string]interface{}{
+			"host":    host,
+			"subsets": subsets,
+		}))
+	}
+
+	return rules
+}
+
+func prepareMeshObject(def SystemDefinition, kind string, name string, spec map[string]interface{}) *unstructured.Unstructured {
+	object := &unstructured.Unstructured{
+		Object: map[string]interface{}{
+			"apiVersion": "networking.istio.io/v1beta1",
+			"kind":       kind,
+			"spec":       spec,
+		},
+	}
+	object.SetName(name)
+	object.SetNamespace(def.Namespace)
+	object.SetLabels(map[string]string{
+		"app.kubernetes.io/name":       def.Name,
+		"app.kubernetes.io/managed-by": labelManagedBy,
+	})
+	object.SetAnnotations(prepareAnnotations(def))
+
+	return object
+}
+
+// createMeshTasks returns tasks creating istio objects of def. Every object is
+// owned by the service of the same name, so that it is garbage collected along
+// with the service.
+func createMeshTasks(client dynamic.Interface, def SystemDefinition, services []*apiv1.Service) []task {
+	owners := make(map[string]*apiv1.Service, len(services))
+	for _, service := range services {
+		owners[service.Name] = service
+	}
+
+	tasks := make([]task, 0)
+	for _, objects := range []struct {
+		kind     string
+		resource schema.GroupVersionResource
+		items    []*unstructured.Unstructured
+	}{
+		{"virtual service", virtualServiceResource, prepareVirtualServices(def)},
+		{"destination rule", destinationRuleResource, prepareDestinationRules(def)},
+	} {
+		objectClient := client.Resource(objects.resource).Namespace(def.Namespace)
+		for _, object := range objects.items {
+			object := object
+			if owner, ok := owners[object.GetName()]; ok {
+				object.SetOwnerReferences([]metav1.OwnerReference{
+					*metav1.NewControllerRef(owner, apiv1.SchemeGroupVersion.WithKind("Service")),
+				})
+			}
+			tasks = append(tasks, task{
+				kind: objects.kind,
+				name: object.GetName(),
+				create: func(ctx context.Context) error {
+					_, err := objectClient.Create(ctx, object, metav1.CreateOptions{})
+					return err
+				},
+				delete: func(ctx context.Context) error {
+					return objectClient.Delete(ctx, object.GetName(), deleteOptions())
+				},
+			})
+		}
+	}
+
+	return tasks
+}
+
+// prepareMeshDeletions returns deletions of istio objects, before they are
+// garbage collected along with their services.
+func prepareMeshDeletions(client dynamic.Interface, namespace string) []deletion {
+	deletions := make([]deletion, 0)
+	for _, objects := range []struct {
+		kind     string
+		resource schema.GroupVersionResource
+	}{
+		{"virtual service", virtualServiceResource},
+		{"destination rule", destinationRuleResource},
+	} {
+		objectClient := client.Resource(objects.resource).Namespace(namespace)
+		deletions = append(deletions, deletion{
+			kind: objects.kind,
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return objectClient.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return objectClient.Delete(ctx, name, deleteOptions())
+			},
+		})
+	}
+
+	return deletions
+}
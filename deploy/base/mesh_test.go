@@ -0,0 +1,98 @@
+package base
+
+import (
+	"context"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/apimachinery/pkg/runtime/schema"
+	dynamicfake "k8s.io/client-go/dynamic/fake"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestValidateMesh(t *testing.T) {
+	tests := []struct {
+		name   string
+		mesh   string
+		call   Call
+		callee Service
+		valid  bool
+	}{
+		{"no mesh", meshNone, Call{Name: "b"}, Service{Name: "b", Type: "base"}, true},
+		{"unknown mesh", "consul", Call{Name: "b"}, Service{Name: "b", Type: "base"}, false},
+		{"istio timeout", meshIstio, Call{Name: "b", Timeout: 500}, Service{Name: "b", Type: "base"}, true},
+		{"linkerd timeout", meshLinkerd, Call{Name: "b", Timeout: 500}, Service{Name: "b", Type: "base"}, false},
+		{"retries without mesh", meshNone, Call{Name: "b", Retries: 2}, Service{Name: "b", Type: "base"}, false},
+		{"async timeout", meshIstio, Call{Name: "b", Async: true, Timeout: 500}, Service{Name: "b", Type: "base"}, false},
+		{"cross-system timeout", meshIstio, Call{Name: "other/b", Timeout: 500}, Service{Name: "b", Type: "base"}, false},
+		{"tcp external timeout", meshIstio, Call{Name: "b", Timeout: 500}, Service{Name: "b", Type: "external"}, false},
+		{"http external timeout", meshIstio, Call{Name: "b", Timeout: 500}, Service{Name: "b", Type: "external", Protocol: protocolHTTP}, true},
+		{"unknown protocol", meshNone, Call{Name: "b"}, Service{Name: "b", Type: "external", Protocol: "udp"}, false},
+		{"protocol of base", meshNone, Call{Name: "b"}, Service{Name: "b", Type: "base", Protocol: protocolGRPC}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def := SystemDefinition{
+				Name: "system",
+				Mesh: test.mesh,
+				Services: []Service{
+					{Name: "a", Type: "base", Calls: []Call{test.call}},
+					test.callee,
+				},
+			}
+			if err := validateMesh(def); (err == nil) != test.valid {
+				t.Errorf("got error %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
+
+func TestServiceProtocol(t *testing.T) {
+	tests := []struct {
+		svc  Service
+		want string
+	}{
+		{Service{Type: "base"}, protocolHTTP},
+		{Service{Type: "mongodb"}, protocolHTTP},
+		{Service{Type: "broker"}, protocolTCP},
+		{Service{Type: "external"}, protocolTCP},
+		{Service{Type: "external", Protocol: protocolGRPC}, protocolGRPC},
+	}
+	for _, test := range tests {
+		if got := test.svc.protocol(); got != test.want {
+			t.Errorf("got protocol %q of %+v, want %q", got, test.svc, test.want)
+		}
+	}
+}
+
+func TestTeardownDeletesMeshObjects(t *testing.T) {
+	def := loadTestDefinition(t, "simple")
+	def.Mesh = meshIstio
+	def.Services[1].Versions = []Version{{Name: "v1"}, {Name: "v2"}}
+	clientset := fake.NewSimpleClientset()
+	dynamicClient := dynamicfake.NewSimpleDynamicClientWithCustomListKinds(runtime.NewScheme(), map[schema.GroupVersionResource]string{
+		virtualServiceResource:  "VirtualServiceList",
+		destinationRuleResource: "DestinationRuleList",
+	})
+
+	if _, err := Deploy(context.Background(), clientset, def, CreateOptions{QPS: 1000, Dynamic: dynamicClient}); err != nil {
+		t.Fatal(err)
+	}
+	rules, err := dynamicClient.Resource(destinationRuleResource).Namespace(def.Namespace).List(context.Background(), metav1.ListOptions{})
+	if err != nil || len(rules.Items) == 0 {
+		t.Fatalf("got no destination rule deployed, error %v", err)
+	}
+	if _, err := Teardown(context.Background(), clientset, dynamicClient, def); err != nil {
+		t.Fatal(err)
+	}
+	for _, resource := range []schema.GroupVersionResource{virtualServiceResource, destinationRuleResource} {
+		objects, err := dynamicClient.Resource(resource).Namespace(def.Namespace).List(context.Background(), metav1.ListOptions{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(objects.Items) > 0 {
+			t.Errorf("got %d %s left, want none", len(objects.Items), resource.Resource)
+		}
+	}
+}
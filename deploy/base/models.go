@@ -2,11 +2,44 @@ package base
 
 type Service struct {
 	id int
+	version string
 	Name string `json:"name"`
 	Workload `json:"workload"`
 	Type string `json:"type"`
-	Node string `json:"node"` // TODO: support multi-node
-	Calls []string `json:"calls"`
+	Image string `json:"image"` // Overrides the default image of service type
+	Node string `json:"node"` // Name of the node to place pods on
+	Calls []Call `json:"calls"`
+	Versions []Version `json:"versions"`
+	Expose string `json:"expose"` // Exposes service outside the cluster
+	Resources *Resources `json:"resources"` // Overrides resources of service container
+	Extends string `json:"extends"` // Inherits unset fields from another service
+	Storage *Storage `json:"storage"` // Persistent volume of database service
+	Port int `json:"port"` // Listening port of external service
+	Env map[string]string `json:"env"` // Env vars of external service
+	Command []string `json:"command"` // Entrypoint of external service
+	Args []string `json:"args"` // Arguments of external service
+	Protocol string `json:"protocol"` // Application protocol of external service: http, http2, grpc or tcp, defaults to tcp
+	Zone string `json:"zone"` // Logical zone the service is placed in
+}
+
+// Call is an edge to a down-stream service. Synchronous calls are written as
+// plain service names in definition files.
+type Call struct {
+	Name string `json:"name"`
+	Async bool `json:"async"` // Publishes to a broker queue instead of calling directly
+	Broker string `json:"broker"` // Broker service of async call, defaults to the only one
+	Timeout int `json:"timeout"` // Mesh timeout of call in milliseconds
+	Retries int `json:"retries"` // Mesh retry attempts of call
+}
+
+// Version is one release of a service running side by side with others.
+// Kubernetes balances a service evenly over its pods, so traffic is split by
+// splitting the system replica count of pods between versions by weight.
+type Version struct {
+	Name string `json:"name"`
+	Image string `json:"image"` // Overrides the image of service
+	Workload *Workload `json:"workload"` // Overrides the workload of service
+	Weight *int32 `json:"weight"` // Traffic share, defaults to 1
 }
 
 type SystemDefinition struct {
@@ -14,9 +47,45 @@ type SystemDefinition struct {
 	Replicas int32 `json:"replicas"`
 	Services []Service `json:"services"`
 	Namespace string `json:"namespace"`
+	Expose string `json:"expose"` // Exposes entry services outside the cluster
+	IngressClass string `json:"ingressClass"`
+	Defaults *Defaults `json:"defaults"` // Fills unset fields of every service
+	Include []string `json:"include"` // Merges services from other definition files
+	LiveWorkload bool `json:"liveWorkload"` // Delivers workload via ConfigMap instead of env vars
+	Zones []Zone `json:"zones"`
+	Mesh string `json:"mesh"` // Service mesh injecting sidecars into services
+	namespaces map[string]string // Namespaces of systems composed with this one
+	clusterIPs map[string]string // Cluster IPs of services once created
+	hash string // Digest of the definition once prepared
+}
+
+type Zone struct {
+	Name string `json:"name"`
+	Topology string `json:"topology"` // Node zone label value to place pods on (Optional)
+	Latency map[string]int `json:"latency"` // Latency in milliseconds to other zones
+}
+
+type Defaults struct {
+	Type string `json:"type"`
+	Workload Workload `json:"workload"`
+	Resources *Resources `json:"resources"`
+}
+
+type Storage struct {
+	Size string `json:"size"` // Volume size, defaults to 1Gi
+	Class string `json:"class"` // Storage class, defaults to the cluster default
+}
+
+type Resources struct {
+	Requests ResourceAmount `json:"requests"`
+	Limits ResourceAmount `json:"limits"`
+}
+
+type ResourceAmount struct {
+	CPU string `json:"cpu"`
+	Memory string `json:"memory"`
 }
 
-// TODO: support memory or cpu cache workload
 type Workload struct {
 	CPU int `json:"cpu"` // CPU relative bogus operation number
 	IO int `json:"io"` // IO relative bogus operation number
@@ -25,9 +94,24 @@ type Workload struct {
 	Memory int `json:"memory"` // Memory object allocation size
 	Read int `json:"read"` // Database read operation number
 	Write int `json:"write"` // Database write operation number
+	Cache `json:"cache"` // Cache access achieved by reading an in-memory working set
+	Failure `json:"failure"` // Failed responses returned at random
+	Timeout int `json:"timeout"` // Timeout of calls to down-stream services in milliseconds
 }
 
 type Delay struct {
 	Duration int `json:"duration"`
 	Jitter int `json:"jitter"`
+}
+
+type Cache struct {
+	Size int `json:"size"` // Working set size
+	Pattern string `json:"pattern"` // Access pattern: sequential, random or zipf
+	Hit int `json:"hit"` // Hit ratio in percent
+}
+
+type Failure struct {
+	Error int `json:"error"` // Probability in percent of responding HTTP 5xx
+	Hang int `json:"hang"` // Probability in percent of hanging until caller times out
+	Truncate int `json:"truncate"` // Probability in percent of responding truncated payload
 }
\ No newline at end of file
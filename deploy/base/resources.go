@@ -0,0 +1,59 @@
+package base
+
+import (
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+)
+
+// applyTo overrides the default requirements of a container with the amounts
+// set in r.
+func (r *Resources) applyTo(requirements *apiv1.ResourceRequirements) {
+	if r == nil {
+		return
+	}
+
+	requirements.Requests = r.Requests.applyTo(requirements.Requests)
+	requirements.Limits = r.Limits.applyTo(requirements.Limits)
+}
+
+func (a ResourceAmount) applyTo(list apiv1.ResourceList) apiv1.ResourceList {
+	if list == nil {
+		list = apiv1.ResourceList{}
+	}
+	if a.CPU != "" {
+		list[apiv1.ResourceCPU] = resource.MustParse(a.CPU)
+	}
+	if a.Memory != "" {
+		list[apiv1.ResourceMemory] = resource.MustParse(a.Memory)
+	}
+
+	return list
+}
+
+// validateResources checks resource amounts and storage sizes of every service
+// of def are valid quantities.
+func validateResources(def SystemDefinition) error {
+	for _, svc := range def.Services {
+		quantities := make([]string, 0)
+		if svc.Resources != nil {
+			quantities = append(quantities,
+				svc.Resources.Requests.CPU, svc.Resources.Requests.Memory,
+				svc.Resources.Limits.CPU, svc.Resources.Limits.Memory)
+		}
+		if svc.Storage != nil {
+			quantities = append(quantities, svc.Storage.Size)
+		}
+
+		for _, quantity := range quantities {
+			if quantity == "" {
+				continue
+			}
+			if _, err := resource.ParseQuantity(quantity); err != nil {
+				return fmt.Errorf("invalid quantity %q of service %q: %v", quantity, svc.Name, err)
+			}
+		}
+	}
+
+	return nil
+}
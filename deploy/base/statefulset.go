@@ -0,0 +1,149 @@
+package base
+
+import (
+	"context"
+	appsv1 "k8s.io/api/apps/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+const dataVolumeName = "data"
+const defaultStorageSize = "1Gi"
+
+// isStateful reports whether svc keeps data and thus is deployed as a
+// StatefulSet with persistent volumes.
+func (svc Service) isStateful() bool {
+	return svc.Type == "mongodb"
+}
+
+func headlessServiceName(sysName string, svcName string) string {
+	return sysName + "-" + svcName + "-headless"
+}
+
+func prepareStatefulSets(def SystemDefinition) ([]*appsv1.StatefulSet, error) {
+	statefulSets := make([]*appsv1.StatefulSet, 0)
+	for i, svc := range def.Services {
+		if !svc.isStateful() {
+			continue
+		}
+
+		replicas := svc.versionReplicas(def.Replicas)
+		for j, version := range svc.versions() {
+			labels, selector := prepareLabels(def, svc, i, version)
+			template, err := preparePodTemplate(def, svc.withVersion(version), labels)
+			if err != nil {
+				return nil, err
+			}
+			statefulSet := &appsv1.StatefulSet{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:        version.resourceName(def.Name, svc.Name),
+					Namespace:   def.Namespace,
+					Labels:      labels,
+					Annotations: prepareAnnotations(def),
+				},
+				Spec: appsv1.StatefulSetSpec{
+					Replicas: int32Ptr(replicas[j]),
+					Selector: &metav1.LabelSelector{
+						MatchLabels: selector,
+					},
+					ServiceName:          headlessServiceName(def.Name, svc.Name),
+					Template:             template,
+					VolumeClaimTemplates: prepareVolumeClaimTemplates(svc),
+				},
+			}
+
+			statefulSets = append(statefulSets, statefulSet)
+		}
+	}
+
+	return statefulSets, nil
+}
+
+func prepareVolumeClaimTemplates(svc Service) []apiv1.PersistentVolumeClaim {
+	size := defaultStorageSize
+	var class *string
+	if svc.Storage != nil {
+		if svc.Storage.Size != "" {
+			size = svc.Storage.Size
+		}
+		if svc.Storage.Class != "" {
+			class = &svc.Storage.Class
+		}
+	}
+
+	return []apiv1.PersistentVolumeClaim{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name: dataVolumeName,
+			},
+			Spec: apiv1.PersistentVolumeClaimSpec{
+				AccessModes: []apiv1.PersistentVolumeAccessMode{
+					apiv1.ReadWriteOnce,
+				},
+				Resources: apiv1.ResourceRequirements{
+					Requests: apiv1.ResourceList{
+						apiv1.ResourceStorage: resource.MustParse(size),
+					},
+				},
+				StorageClassName: class,
+			},
+		},
+	}
+}
+
+func prepareHeadlessService(def SystemDefinition, svc Service) *apiv1.Service {
+	return &apiv1.Service{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      headlessServiceName(def.Name, svc.Name),
+			Namespace: def.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       def.Name,
+				"app.kubernetes.io/managed-by": labelManagedBy,
+			},
+		},
+		Spec: apiv1.ServiceSpec{
+			ClusterIP: apiv1.ClusterIPNone,
+			Ports: []apiv1.ServicePort{
+				{
+					Name:        protocolHTTP,
+					AppProtocol: stringPtr(protocolHTTP),
+					Protocol:    "TCP",
+					Port:        int32(baseListeningPort),
+				},
+			},
+			Selector: map[string]string{
+				"app.kubernetes.io/name":       def.Name,
+				"app.kubernetes.io/managed-by": labelManagedBy,
+				benServiceName:                 svc.Name,
+			},
+		},
+	}
+}
+
+func createStatefulSetTasks(clientset kubernetes.Interface, def SystemDefinition) ([]task, error) {
+	statefulSets, err := prepareStatefulSets(def)
+	if err != nil {
+		return nil, err
+	}
+
+	statefulSetsClient := clientset.AppsV1().StatefulSets(def.Namespace)
+	tasks := make([]task, len(statefulSets))
+	for i, statefulSet := range statefulSets {
+		statefulSet := statefulSet
+		tasks[i] = task{
+			kind: "stateful set",
+			name: statefulSet.Name,
+			create: func(ctx context.Context) error {
+				_, err := statefulSetsClient.Create(ctx, statefulSet, metav1.CreateOptions{})
+				return err
+			},
+			delete: func(ctx context.Context) error {
+				return statefulSetsClient.Delete(ctx, statefulSet.Name, deleteOptions())
+			},
+		}
+	}
+
+	return tasks, nil
+}
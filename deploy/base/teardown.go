@@ -0,0 +1,183 @@
+package base
+
+import (
+	"context"
+	"fmt"
+	"k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/runtime"
+	"k8s.io/client-go/dynamic"
+	"k8s.io/client-go/kubernetes"
+	"strings"
+)
+
+// TeardownResult describes a system removed by Teardown.
+type TeardownResult struct {
+	System    string
+	Namespace string
+	Deleted   int // Number of resources deleted
+}
+
+// TeardownError collects every resource failed to be deleted for a system.
+type TeardownError struct {
+	System string
+	Errors []*ResourceError
+}
+
+func (e *TeardownError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("failed to delete %d resources of %q: %s", len(e.Errors), e.System, strings.Join(messages, "; "))
+}
+
+// deletion lists & deletes resources of one kind.
+type deletion struct {
+	kind   string
+	list   func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error)
+	delete func(ctx context.Context, name string) error
+}
+
+// Teardown deletes every resource deployed for def, found by labels of the
+// system, including volumes claimed by stateful services. Mesh objects are
+// deleted through dynamicClient, unless nil. The namespace is kept, as it may
+// be shared with other systems.
+func Teardown(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, def SystemDefinition) (*TeardownResult, error) {
+	selector := metav1.ListOptions{
+		LabelSelector: fmt.Sprintf("app.kubernetes.io/managed-by=%s,app.kubernetes.io/name=%s", labelManagedBy, def.Name),
+	}
+	result := &TeardownResult{
+		System:    def.Name,
+		Namespace: def.Namespace,
+	}
+	errs := make([]*ResourceError, 0)
+
+	deletions := prepareDeletions(clientset, def.Namespace)
+	if dynamicClient != nil {
+		// Mesh objects are created last
+		deletions = append(prepareMeshDeletions(dynamicClient, def.Namespace), deletions...)
+	}
+
+	fmt.Printf("Deleting %q...\n", def.Name)
+	for _, d := range deletions {
+		names, err := listNames(d.list(ctx, selector))
+		if errors.IsNotFound(err) {
+			// Custom resources of the mesh may not be installed
+			continue
+		}
+		if err != nil {
+			errs = append(errs, &ResourceError{Kind: d.kind, Name: selector.LabelSelector, Err: err})
+			continue
+		}
+
+		for _, name := range names {
+			if err := d.delete(ctx, name); err != nil && !errors.IsNotFound(err) {
+				fmt.Printf("- Failed to delete %s %q: %v\n", d.kind, name, err)
+				errs = append(errs, &ResourceError{Kind: d.kind, Name: name, Err: err})
+				continue
+			}
+			fmt.Printf("- Deleted %s %q.\n", d.kind, name)
+			result.Deleted++
+		}
+	}
+
+	if len(errs) > 0 {
+		return result, &TeardownError{System: def.Name, Errors: errs}
+	}
+	fmt.Printf("Done.\n")
+
+	return result, nil
+}
+
+func listNames(list runtime.Object, err error) ([]string, error) {
+	if err != nil {
+		return nil, err
+	}
+	items, err := meta.ExtractList(list)
+	if err != nil {
+		return nil, err
+	}
+
+	names := make([]string, len(items))
+	for i, item := range items {
+		object, err := meta.Accessor(item)
+		if err != nil {
+			return nil, err
+		}
+		names[i] = object.GetName()
+	}
+
+	return names, nil
+}
+
+// prepareDeletions returns deletions of every kind of resource deployed, in
+// reverse order of creation.
+func prepareDeletions(clientset kubernetes.Interface, namespace string) []deletion {
+	deployments := clientset.AppsV1().Deployments(namespace)
+	statefulSets := clientset.AppsV1().StatefulSets(namespace)
+	ingresses := clientset.NetworkingV1().Ingresses(namespace)
+	services := clientset.CoreV1().Services(namespace)
+	configMaps := clientset.CoreV1().ConfigMaps(namespace)
+	claims := clientset.CoreV1().PersistentVolumeClaims(namespace)
+
+	return []deletion{
+		{
+			kind: "deployment",
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return deployments.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return deployments.Delete(ctx, name, deleteOptions())
+			},
+		},
+		{
+			kind: "stateful set",
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return statefulSets.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return statefulSets.Delete(ctx, name, deleteOptions())
+			},
+		},
+		{
+			kind: "ingress",
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return ingresses.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return ingresses.Delete(ctx, name, deleteOptions())
+			},
+		},
+		{
+			kind: "service",
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return services.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return services.Delete(ctx, name, deleteOptions())
+			},
+		},
+		{
+			kind: "config map",
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return configMaps.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return configMaps.Delete(ctx, name, deleteOptions())
+			},
+		},
+		{
+			// Claims are labelled by the selector of their stateful sets
+			kind: "persistent volume claim",
+			list: func(ctx context.Context, opts metav1.ListOptions) (runtime.Object, error) {
+				return claims.List(ctx, opts)
+			},
+			delete: func(ctx context.Context, name string) error {
+				return claims.Delete(ctx, name, deleteOptions())
+			},
+		},
+	}
+}
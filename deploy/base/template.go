@@ -0,0 +1,217 @@
+package base
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/util/yaml"
+	"os"
+	"path/filepath"
+	"regexp"
+)
+
+var variablePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)\}`)
+
+// definitionFile keeps services & defaults of a definition file as decoded
+// YAML maps, so that fields explicitly set to zero values, false or "" are
+// told apart from unset ones while inheriting.
+type definitionFile struct {
+	Services []map[string]interface{} `json:"services"`
+	Defaults map[string]interface{} `json:"defaults"`
+}
+
+// defaultFields are the fields of services filled by system defaults.
+var defaultFields = []string{"type", "workload", "resources"}
+
+// LoadSystemDefinition reads the system definition file at path and expands
+// its templating: ${VAR} variables are substituted from vars or environment
+// variables, included files are merged, and every service inherits unset
+// fields from the service it extends and then from system defaults.
+func LoadSystemDefinition(path string, vars map[string]string) (SystemDefinition, error) {
+	def, file, err := loadDefinitionFile(path, vars, map[string]bool{})
+	if err != nil {
+		return SystemDefinition{}, err
+	}
+
+	services, err := resolveExtends(file.Services)
+	if err != nil {
+		return SystemDefinition{}, err
+	}
+	if file.Defaults != nil {
+		defaults := make(map[string]interface{}, len(defaultFields))
+		for _, field := range defaultFields {
+			if value, ok := file.Defaults[field]; ok {
+				defaults[field] = value
+			}
+		}
+		for i := range services {
+			services[i] = inherit(services[i], defaults)
+		}
+	}
+
+	// Services are decoded only once every field is inherited
+	servicesJSON, err := json.Marshal(services)
+	if err != nil {
+		return SystemDefinition{}, err
+	}
+	def.Services = nil
+	if err := json.Unmarshal(servicesJSON, &def.Services); err != nil {
+		return SystemDefinition{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return def, nil
+}
+
+func loadDefinitionFile(path string, vars map[string]string, visited map[string]bool) (SystemDefinition, definitionFile, error) {
+	absPath, err := filepath.Abs(path)
+	if err != nil {
+		return SystemDefinition{}, definitionFile{}, err
+	}
+	if visited[absPath] {
+		return SystemDefinition{}, definitionFile{}, fmt.Errorf("definition file %q is included recursively", path)
+	}
+	visited[absPath] = true
+	defer delete(visited, absPath)
+
+	defStr, err := ioutil.ReadFile(absPath)
+	if err != nil {
+		return SystemDefinition{}, definitionFile{}, err
+	}
+	defStr, err = substituteVariables(defStr, vars)
+	if err != nil {
+		return SystemDefinition{}, definitionFile{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var def SystemDefinition
+	var file definitionFile
+	if err := yaml.Unmarshal(defStr, &def); err != nil {
+		return SystemDefinition{}, definitionFile{}, fmt.Errorf("%s: %w", path, err)
+	}
+	if err := yaml.Unmarshal(defStr, &file); err != nil {
+		return SystemDefinition{}, definitionFile{}, fmt.Errorf("%s: %w", path, err)
+	}
+
+	// Services of included files come first, in order of inclusion
+	services := make([]map[string]interface{}, 0)
+	for _, include := range def.Include {
+		if !filepath.IsAbs(include) {
+			include = filepath.Join(filepath.Dir(absPath), include)
+		}
+		included, includedFile, err := loadDefinitionFile(include, vars, visited)
+		if err != nil {
+			return SystemDefinition{}, definitionFile{}, err
+		}
+
+		services = append(services, includedFile.Services...)
+		if def.Defaults == nil {
+			def.Defaults = included.Defaults
+			file.Defaults = includedFile.Defaults
+		}
+	}
+	file.Services = append(services, file.Services...)
+	def.Include = nil
+
+	return def, file, nil
+}
+
+func substituteVariables(defStr []byte, vars map[string]string) ([]byte, error) {
+	var err error
+	result := variablePattern.ReplaceAllFunc(defStr, func(match []byte) []byte {
+		name := string(variablePattern.FindSubmatch(match)[1])
+		if value, ok := vars[name]; ok {
+			return []byte(value)
+		}
+		if value, ok := os.LookupEnv(name); ok {
+			return []byte(value)
+		}
+
+		err = fmt.Errorf("variable %q is not set", name)
+		return match
+	})
+
+	return result, err
+}
+
+// resolveExtends makes every service inherit unset fields from the service it
+// extends, which may extend another service in turn.
+func resolveExtends(services []map[string]interface{}) ([]map[string]interface{}, error) {
+	name := func(svc map[string]interface{}, key string) string {
+		value, _ := svc[key].(string)
+		return value
+	}
+	byName := make(map[string]int, len(services))
+	for i, svc := range services {
+		byName[name(svc, "name")] = i
+	}
+
+	resolved := make([]bool, len(services))
+	var resolve func(i int, chain map[int]bool) error
+	resolve = func(i int, chain map[int]bool) error {
+		if resolved[i] || name(services[i], "extends") == "" {
+			resolved[i] = true
+			return nil
+		}
+		if chain[i] {
+			return fmt.Errorf("service %q extends itself recursively", name(services[i], "name"))
+		}
+		chain[i] = true
+
+		parent, ok := byName[name(services[i], "extends")]
+		if !ok {
+			return fmt.Errorf("service %q extends unknown service %q", name(services[i], "name"), name(services[i], "extends"))
+		}
+		if err := resolve(parent, chain); err != nil {
+			return err
+		}
+
+		services[i] = inherit(services[i], services[parent])
+		resolved[i] = true
+		return nil
+	}
+
+	for i := range services {
+		if err := resolve(i, map[int]bool{}); err != nil {
+			return nil, err
+		}
+	}
+
+	return services, nil
+}
+
+// inherit returns svc with every unset field filled with the value in parent.
+// Name is never inherited.
+func inherit(svc map[string]interface{}, parent map[string]interface{}) map[string]interface{} {
+	inherited := mergeFields(svc, parent)
+	if name, ok := svc["name"]; ok {
+		inherited["name"] = name
+	} else {
+		delete(inherited, "name")
+	}
+
+	return inherited
+}
+
+// mergeFields returns fields of dst over those of src, merging nested objects
+// field by field. Fields set to null are unset, unlike those set to zero
+// values, false or "".
+func mergeFields(dst map[string]interface{}, src map[string]interface{}) map[string]interface{} {
+	merged := make(map[string]interface{}, len(dst)+len(src))
+	for key, value := range src {
+		merged[key] = value
+	}
+	for key, value := range dst {
+		if value == nil {
+			continue
+		}
+
+		dstObject, dstIsObject := value.(map[string]interface{})
+		srcObject, srcIsObject := merged[key].(map[string]interface{})
+		if dstIsObject && srcIsObject {
+			merged[key] = mergeFields(dstObject, srcObject)
+		} else {
+			merged[key] = value
+		}
+	}
+
+	return merged
+}
@@ -0,0 +1,80 @@
+package base
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestMergeFields(t *testing.T) {
+	tests := []struct {
+		name string
+		dst  map[string]interface{}
+		src  map[string]interface{}
+		want map[string]interface{}
+	}{
+		{"unset", map[string]interface{}{}, map[string]interface{}{"port": 80.0}, map[string]interface{}{"port": 80.0}},
+		{"null", map[string]interface{}{"port": nil}, map[string]interface{}{"port": 80.0}, map[string]interface{}{"port": 80.0}},
+		{"zero", map[string]interface{}{"port": 0.0}, map[string]interface{}{"port": 80.0}, map[string]interface{}{"port": 0.0}},
+		{"false", map[string]interface{}{"async": false}, map[string]interface{}{"async": true}, map[string]interface{}{"async": false}},
+		{"empty string", map[string]interface{}{"image": ""}, map[string]interface{}{"image": "nginx"}, map[string]interface{}{"image": ""}},
+		{"empty list", map[string]interface{}{"calls": []interface{}{}}, map[string]interface{}{"calls": []interface{}{"b"}}, map[string]interface{}{"calls": []interface{}{}}},
+		{"nested", map[string]interface{}{
+			"workload": map[string]interface{}{"cpu": 0.0, "delay": map[string]interface{}{"jitter": 5.0}},
+		}, map[string]interface{}{
+			"workload": map[string]interface{}{"cpu": 10.0, "net": 128.0, "delay": map[string]interface{}{"duration": 50.0}},
+		}, map[string]interface{}{
+			"workload": map[string]interface{}{"cpu": 0.0, "net": 128.0, "delay": map[string]interface{}{"duration": 50.0, "jitter": 5.0}},
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := mergeFields(test.dst, test.src); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestLoadSystemDefinitionInheritsUnsetFields(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "system.yaml")
+	defYAML := `name: system
+replicas: 1
+namespace: system
+defaults:
+  type: base
+  workload:
+    net: 4096
+services:
+  - name: a
+    workload:
+      cpu: 10
+      io: 5
+    calls:
+      - c
+  - name: b
+    extends: a
+    workload:
+      cpu: 0
+      net: 0
+    calls: []
+  - name: c
+`
+	if err := ioutil.WriteFile(path, []byte(defYAML), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	def, err := LoadSystemDefinition(path, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []Service{
+		{Name: "a", Type: "base", Workload: Workload{CPU: 10, IO: 5, Net: 4096}, Calls: []Call{{Name: "c"}}},
+		{Name: "b", Type: "base", Workload: Workload{IO: 5}, Calls: []Call{}, Extends: "a"},
+		{Name: "c", Type: "base", Workload: Workload{Net: 4096}},
+	}
+	if !reflect.DeepEqual(def.Services, want) {
+		t.Errorf("got services %+v, want %+v", def.Services, want)
+	}
+}
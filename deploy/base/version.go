@@ -0,0 +1,117 @@
+package base
+
+import "fmt"
+
+const benServiceVersion = "vecro-sim/service-version"
+
+// versions returns every version of the service to be deployed. A service
+// without versions runs as a single unnamed version.
+func (svc Service) versions() []Version {
+	if len(svc.Versions) == 0 {
+		return []Version{{}}
+	}
+
+	return svc.Versions
+}
+
+// withVersion returns the service as it runs in version v.
+func (svc Service) withVersion(v Version) Service {
+	svc.version = v.Name
+	if v.Image != "" {
+		svc.Image = v.Image
+	}
+	if v.Workload != nil {
+		svc.Workload = *v.Workload
+	}
+
+	return svc
+}
+
+// weight returns the traffic share of version v.
+func (v Version) weight() int32 {
+	if v.Weight == nil {
+		return 1
+	}
+
+	return *v.Weight
+}
+
+// validateVersions checks versions of every service of def have unique,
+// non-empty names and weights that are valid traffic shares.
+func validateVersions(def SystemDefinition) error {
+	for _, svc := range def.Services {
+		total := int32(0)
+		names := make(map[string]bool)
+		for _, version := range svc.Versions {
+			if version.Name == "" {
+				return fmt.Errorf("a version of service %q has no name", svc.Name)
+			}
+			if names[version.Name] {
+				return fmt.Errorf("version %q of service %q is defined more than once", version.Name, svc.Name)
+			}
+			names[version.Name] = true
+			if version.weight() < 0 {
+				return fmt.Errorf("version %q of service %q has negative weight %d", version.Name, svc.Name, version.weight())
+			}
+			total += version.weight()
+		}
+		if len(svc.Versions) > 0 && total == 0 {
+			return fmt.Errorf("versions of service %q have a total weight of zero", svc.Name)
+		}
+	}
+
+	return nil
+}
+
+// versionReplicas splits systemReplicas between versions of svc by weight,
+// in the same order. Pods left over by rounding down go to the versions with
+// the largest remainders, so that the counts add up to systemReplicas.
+func (svc Service) versionReplicas(systemReplicas int32) []int32 {
+	versions := svc.versions()
+	if len(svc.Versions) == 0 {
+		return []int32{systemReplicas}
+	}
+
+	total := int64(0)
+	for _, version := range versions {
+		total += int64(version.weight())
+	}
+	replicas := make([]int32, len(versions))
+	remainders := make([]int64, len(versions))
+	left := systemReplicas
+	for i, version := range versions {
+		share := int64(systemReplicas) * int64(version.weight())
+		replicas[i] = int32(share / total)
+		remainders[i] = share % total
+		left -= replicas[i]
+	}
+	for ; left > 0; left-- {
+		largest := 0
+		for i := range remainders {
+			if remainders[i] > remainders[largest] {
+				largest = i
+			}
+		}
+		replicas[largest]++
+		remainders[largest] = -1
+	}
+
+	return replicas
+}
+
+// resourceName returns the name of Kubernetes workload resource of version v.
+func (v Version) resourceName(sysName string, svcName string) string {
+	if v.Name == "" {
+		return sysName + "-" + svcName
+	}
+
+	return sysName + "-" + svcName + "-" + v.Name
+}
+
+func (svc Service) imageOr(defaultImage string) string {
+	if svc.Image == "" {
+		return defaultImage
+	}
+
+	return svc.Image
+}
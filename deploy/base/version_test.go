@@ -0,0 +1,64 @@
+package base
+
+import (
+	"reflect"
+	"testing"
+)
+
+func weightedVersions(weights ...int32) []Version {
+	versions := make([]Version, len(weights))
+	for i := range weights {
+		versions[i] = Version{Name: string(rune('a' + i)), Weight: &weights[i]}
+	}
+
+	return versions
+}
+
+func TestVersionReplicas(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []Version
+		replicas int32
+		want     []int32
+	}{
+		{"unversioned", nil, 3, []int32{3}},
+		{"unset weights", []Version{{Name: "a"}, {Name: "b"}}, 4, []int32{2, 2}},
+		{"canary", weightedVersions(90, 10), 10, []int32{9, 1}},
+		{"canary of one replica", weightedVersions(90, 10), 1, []int32{1, 0}},
+		{"largest remainder", weightedVersions(1, 1, 1), 2, []int32{1, 1, 0}},
+		{"zero weight", weightedVersions(3, 0), 3, []int32{3, 0}},
+		{"scaled to zero", weightedVersions(3, 1), 0, []int32{0, 0}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			svc := Service{Name: "svc", Versions: test.versions}
+			if got := svc.versionReplicas(test.replicas); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got replicas %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestValidateVersions(t *testing.T) {
+	tests := []struct {
+		name     string
+		versions []Version
+		valid    bool
+	}{
+		{"unversioned", nil, true},
+		{"unset weights", []Version{{Name: "a"}, {Name: "b"}}, true},
+		{"zero weight", weightedVersions(1, 0), true},
+		{"zero total", weightedVersions(0, 0), false},
+		{"negative weight", weightedVersions(2, -1), false},
+		{"empty name", []Version{{Name: "a"}, {}}, false},
+		{"duplicate name", []Version{{Name: "a"}, {Name: "a"}}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def := SystemDefinition{Services: []Service{{Name: "svc", Versions: test.versions}}}
+			if err := validateVersions(def); (err == nil) != test.valid {
+				t.Errorf("got error %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
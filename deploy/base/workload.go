@@ -1,8 +1,14 @@
 package base
 
 import (
+	"context"
+	"fmt"
 	v1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
 	"strconv"
+	"strings"
 )
 
 const (
@@ -14,6 +20,20 @@ const (
 	workloadMemoryEnvKey        = "VECRO_WORKLOAD_MEMORY"
 	dbReadOpsEnvKey     		= "VECRO_DB_READ_OPS"
 	dbWriteOpsEnvKey    		= "VECRO_DB_WRITE_OPS"
+	workloadCacheSizeEnvKey     = "VECRO_WORKLOAD_CACHE_SIZE"
+	workloadCachePatternEnvKey  = "VECRO_WORKLOAD_CACHE_PATTERN"
+	workloadCacheHitEnvKey      = "VECRO_WORKLOAD_CACHE_HIT"
+	workloadErrorEnvKey         = "VECRO_WORKLOAD_FAILURE_ERROR"
+	workloadHangEnvKey          = "VECRO_WORKLOAD_FAILURE_HANG"
+	workloadTruncateEnvKey      = "VECRO_WORKLOAD_FAILURE_TRUNCATE"
+	callTimeoutEnvKey           = "VECRO_CALL_TIMEOUT"
+)
+
+const (
+	workloadFileEnvKey = "VECRO_WORKLOAD_FILE"
+	workloadVolumeName = "workload-config"
+	workloadMountPath  = "/etc/vecro/workload"
+	workloadFileName   = "workload.env"
 )
 
 func (w Workload) toWorkloadEnvVar() []v1.EnvVar {
@@ -50,5 +70,276 @@ func (w Workload) toWorkloadEnvVar() []v1.EnvVar {
 			Name:  dbWriteOpsEnvKey,
 			Value: strconv.Itoa(w.Write),
 		},
+		{
+			Name:  workloadCacheSizeEnvKey,
+			Value: strconv.Itoa(w.Cache.Size),
+		},
+		{
+			Name:  workloadCachePatternEnvKey,
+			Value: w.Cache.Pattern,
+		},
+		{
+			Name:  workloadCacheHitEnvKey,
+			Value: strconv.Itoa(w.Cache.Hit),
+		},
+		{
+			Name:  workloadErrorEnvKey,
+			Value: strconv.Itoa(w.Failure.Error),
+		},
+		{
+			Name:  workloadHangEnvKey,
+			Value: strconv.Itoa(w.Failure.Hang),
+		},
+		{
+			Name:  workloadTruncateEnvKey,
+			Value: strconv.Itoa(w.Failure.Truncate),
+		},
+		{
+			Name:  callTimeoutEnvKey,
+			Value: strconv.Itoa(w.Timeout),
+		},
+	}
+}
+
+// toWorkloadFile renders workload config in the env file format, one
+// KEY=VALUE pair per line.
+func (w Workload) toWorkloadFile() string {
+	var b strings.Builder
+	for _, env := range w.toWorkloadEnvVar() {
+		b.WriteString(env.Name + "=" + env.Value + "\n")
+	}
+
+	return b.String()
+}
+
+// fromWorkloadEnvVar decodes workload config from env vars, reversing
+// toWorkloadEnvVar.
+func fromWorkloadEnvVar(envs map[string]string) Workload {
+	atoi := func(key string) int {
+		value, _ := strconv.Atoi(envs[key])
+		return value
+	}
+
+	return Workload{
+		CPU: atoi(workloadCPUEnvKey),
+		IO:  atoi(workloadIOEnvKey),
+		Delay: Delay{
+			Duration: atoi(workloadDelayDurationEnvKey),
+			Jitter:   atoi(workloadDelayJitterEnvKey),
+		},
+		Net:    atoi(workloadNetEnvKey),
+		Memory: atoi(workloadMemoryEnvKey),
+		Read:   atoi(dbReadOpsEnvKey),
+		Write:  atoi(dbWriteOpsEnvKey),
+		Cache: Cache{
+			Size:    atoi(workloadCacheSizeEnvKey),
+			Pattern: envs[workloadCachePatternEnvKey],
+			Hit:     atoi(workloadCacheHitEnvKey),
+		},
+		Failure: Failure{
+			Error:    atoi(workloadErrorEnvKey),
+			Hang:     atoi(workloadHangEnvKey),
+			Truncate: atoi(workloadTruncateEnvKey),
+		},
+		Timeout: atoi(callTimeoutEnvKey),
+	}
+}
+
+// parseWorkloadFile parses workload config in the env file format.
+func parseWorkloadFile(content string) map[string]string {
+	envs := make(map[string]string)
+	for _, line := range strings.Split(content, "\n") {
+		kv := strings.SplitN(line, "=", 2)
+		if len(kv) == 2 {
+			envs[kv[0]] = kv[1]
+		}
 	}
+
+	return envs
+}
+
+// validateWorkloads checks percentages in workloads of every version of every
+// service of def are within 0 to 100, failure probabilities add up to 100 at
+// most, cache sizes and call timeouts are not negative, and cache patterns are
+// supported.
+func validateWorkloads(def SystemDefinition) error {
+	for _, svc := range def.Services {
+		for _, version := range svc.versions() {
+			w := svc.withVersion(version).Workload
+			percentages := []struct {
+				field string
+				value int
+			}{
+				{"cache.hit", w.Cache.Hit},
+				{"failure.error", w.Failure.Error},
+				{"failure.hang", w.Failure.Hang},
+				{"failure.truncate", w.Failure.Truncate},
+			}
+			for _, percentage := range percentages {
+				if percentage.value < 0 || percentage.value > 100 {
+					return fmt.Errorf("workload %s of service %q is %d, which is not a percentage between 0 and 100", percentage.field, svc.Name, percentage.value)
+				}
+			}
+			if failure := w.Failure.Error + w.Failure.Hang + w.Failure.Truncate; failure > 100 {
+				return fmt.Errorf("workload failure probabilities of service %q add up to %d, which exceeds 100", svc.Name, failure)
+			}
+			switch w.Cache.Pattern {
+			case "", cachePatternSequential, cachePatternRandom, cachePatternZipf:
+			default:
+				return fmt.Errorf("invalid cache pattern %q of service %q.\nSupported options: sequential, random, zipf", w.Cache.Pattern, svc.Name)
+			}
+			if w.Cache.Size < 0 {
+				return fmt.Errorf("workload cache.size of service %q is negative", svc.Name)
+			}
+			if w.Timeout < 0 {
+				return fmt.Errorf("workload timeout of service %q is negative", svc.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// workloadConfigKey returns the key of workload config of svc in the system
+// workload ConfigMap.
+func (svc Service) workloadConfigKey() string {
+	if svc.version == "" {
+		return svc.Name
+	}
+
+	return svc.Name + "-" + svc.version
+}
+
+func workloadConfigMapName(sysName string) string {
+	return sysName + "-workload"
+}
+
+// prepareWorkloadEnvVar returns the env vars delivering workload config of svc.
+// Live workload is additionally read from a file mounted from the system
+// workload ConfigMap, which kubelet keeps in sync without restarting pods.
+// Env vars are kept for images reading workload from them only, which run the
+// workload deployed until pods are restarted.
+func prepareWorkloadEnvVar(svc Service, def SystemDefinition) []v1.EnvVar {
+	envs := svc.toWorkloadEnvVar()
+	if !def.LiveWorkload {
+		return envs
+	}
+
+	return append(envs, v1.EnvVar{
+		Name:  workloadFileEnvKey,
+		Value: workloadMountPath + "/" + workloadFileName,
+	})
+}
+
+func prepareWorkloadVolumeMounts(def SystemDefinition) []v1.VolumeMount {
+	if !def.LiveWorkload {
+		return nil
+	}
+
+	return []v1.VolumeMount{
+		{
+			Name:      workloadVolumeName,
+			MountPath: workloadMountPath,
+			ReadOnly:  true,
+		},
+	}
+}
+
+func prepareWorkloadVolumes(svc Service, def SystemDefinition) []v1.Volume {
+	if !def.LiveWorkload {
+		return nil
+	}
+
+	return []v1.Volume{
+		{
+			Name: workloadVolumeName,
+			VolumeSource: v1.VolumeSource{
+				ConfigMap: &v1.ConfigMapVolumeSource{
+					LocalObjectReference: v1.LocalObjectReference{
+						Name: workloadConfigMapName(def.Name),
+					},
+					Items: []v1.KeyToPath{
+						{
+							Key:  svc.workloadConfigKey(),
+							Path: workloadFileName,
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func prepareWorkloadConfigMap(def SystemDefinition) *v1.ConfigMap {
+	data := make(map[string]string)
+	for _, svc := range def.Services {
+		for _, version := range svc.versions() {
+			versioned := svc.withVersion(version)
+			data[versioned.workloadConfigKey()] = versioned.Workload.toWorkloadFile()
+		}
+	}
+
+	return &v1.ConfigMap{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      workloadConfigMapName(def.Name),
+			Namespace: def.Namespace,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       def.Name,
+				"app.kubernetes.io/managed-by": labelManagedBy,
+			},
+		},
+		Data: data,
+	}
+}
+
+func createWorkloadConfigMapTasks(clientset kubernetes.Interface, def SystemDefinition) []task {
+	if !def.LiveWorkload {
+		return nil
+	}
+
+	configMap := prepareWorkloadConfigMap(def)
+	configMapClient := clientset.CoreV1().ConfigMaps(def.Namespace)
+	return []task{
+		{
+			kind: "config map",
+			name: configMap.Name,
+			create: func(ctx context.Context) error {
+				_, err := configMapClient.Create(ctx, configMap, metav1.CreateOptions{})
+				return err
+			},
+			delete: func(ctx context.Context) error {
+				return configMapClient.Delete(ctx, configMap.Name, deleteOptions())
+			},
+		},
+	}
+}
+
+// UpdateWorkload replaces the live workload config of a deployed system with
+// the workload in def. Running services pick up the change once kubelet syncs
+// the mounted ConfigMap, usually within a minute.
+func UpdateWorkload(ctx context.Context, clientset kubernetes.Interface, def SystemDefinition) error {
+	if !def.LiveWorkload {
+		return fmt.Errorf("system %q is not deployed with live workload enabled", def.Name)
+	}
+	if err := validateDefinition(&def); err != nil {
+		return err
+	}
+
+	configMapClient := clientset.CoreV1().ConfigMaps(def.Namespace)
+	configMap := prepareWorkloadConfigMap(def)
+	current, err := configMapClient.Get(ctx, configMap.Name, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return fmt.Errorf("workload config map of system %q is not found, deploy the system first", def.Name)
+	} else if err != nil {
+		return err
+	}
+
+	configMap.ResourceVersion = current.ResourceVersion
+	result, err := configMapClient.Update(ctx, configMap, metav1.UpdateOptions{})
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Updated workload config map %q for %q.\n", result.GetObjectMeta().GetName(), def.Name)
+
+	return nil
 }
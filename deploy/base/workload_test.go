@@ -0,0 +1,66 @@
+package base
+
+import "testing"
+
+func TestPrepareWorkloadEnvVar(t *testing.T) {
+	svc := Service{Name: "svc", Workload: Workload{CPU: 3}}
+	tests := []struct {
+		name string
+		live bool
+	}{
+		{"env vars", false},
+		{"live workload", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			envs := make(map[string]string)
+			for _, env := range prepareWorkloadEnvVar(svc, SystemDefinition{LiveWorkload: test.live}) {
+				envs[env.Name] = env.Value
+			}
+			if envs[workloadCPUEnvKey] != "3" {
+				t.Errorf("got %s=%q, want 3", workloadCPUEnvKey, envs[workloadCPUEnvKey])
+			}
+			if _, ok := envs[workloadFileEnvKey]; ok != test.live {
+				t.Errorf("got %s set %v, want %v", workloadFileEnvKey, ok, test.live)
+			}
+		})
+	}
+}
+
+func TestValidateWorkloads(t *testing.T) {
+	tests := []struct {
+		name     string
+		workload Workload
+		valid    bool
+	}{
+		{"unset", Workload{}, true},
+		{"cache hit", Workload{Cache: Cache{Hit: 100}}, true},
+		{"cache hit above 100", Workload{Cache: Cache{Hit: 101}}, false},
+		{"negative cache hit", Workload{Cache: Cache{Hit: -1}}, false},
+		{"cache pattern", Workload{Cache: Cache{Size: 1024, Pattern: "zipf"}}, true},
+		{"unknown cache pattern", Workload{Cache: Cache{Pattern: "lru"}}, false},
+		{"negative cache size", Workload{Cache: Cache{Size: -1}}, false},
+		{"failures", Workload{Failure: Failure{Error: 5, Hang: 1, Truncate: 94}}, true},
+		{"failures above 100 altogether", Workload{Failure: Failure{Error: 50, Hang: 30, Truncate: 30}}, false},
+		{"error above 100", Workload{Failure: Failure{Error: 150}}, false},
+		{"negative hang", Workload{Failure: Failure{Hang: -5}}, false},
+		{"truncate above 100", Workload{Failure: Failure{Truncate: 101}}, false},
+		{"timeout", Workload{Timeout: 500}, true},
+		{"negative timeout", Workload{Timeout: -1}, false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			def := SystemDefinition{Services: []Service{{Name: "svc", Workload: test.workload}}}
+			if err := validateWorkloads(def); (err == nil) != test.valid {
+				t.Errorf("got error %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+
+	// Versions override the workload of the service
+	workload := Workload{Cache: Cache{Hit: 200}}
+	def := SystemDefinition{Services: []Service{{Name: "svc", Versions: []Version{{Name: "v1"}, {Name: "v2", Workload: &workload}}}}}
+	if err := validateWorkloads(def); err == nil {
+		t.Error("got no error of version workload")
+	}
+}
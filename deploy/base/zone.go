@@ -0,0 +1,233 @@
+package base
+
+import (
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const benZone = "vecro-sim/zone"
+const topologyZoneLabel = "topology.kubernetes.io/zone"
+const tcImage = "gaiadocker/iproute2"
+
+// ZoneLatencyContainer is the init container installing the root qdisc that
+// delays traffic of a pod to other zones. Pumba replaces the root qdisc of
+// the pod with its own netem, so net faults would drop zone latency.
+const ZoneLatencyContainer = "zone-latency"
+
+var (
+	tcDelayPattern  = regexp.MustCompile(`parent 1:(\d+) handle \d+: netem delay (\d+)ms`)
+	tcFilterPattern = regexp.MustCompile(`match ip dst ([0-9.]+)/32 flowid 1:(\d+)`)
+)
+
+// Bands 0-2 of the prio qdisc carry traffic within the zone as usual, the
+// following ones delay traffic to other zones.
+const tcDefaultBands = 3
+const tcMaxBands = 16
+
+// latency returns the latency in milliseconds between two zones. Latency is
+// symmetric unless set in both directions.
+func (def SystemDefinition) latency(from string, to string) int {
+	if from == to {
+		return 0
+	}
+
+	for _, zone := range def.Zones {
+		if zone.Name == from {
+			if latency, ok := zone.Latency[to]; ok {
+				return latency
+			}
+		}
+	}
+	for _, zone := range def.Zones {
+		if zone.Name == to {
+			return zone.Latency[from]
+		}
+	}
+
+	return 0
+}
+
+func (def SystemDefinition) zone(name string) *Zone {
+	for i := range def.Zones {
+		if def.Zones[i].Name == name {
+			return &def.Zones[i]
+		}
+	}
+
+	return nil
+}
+
+func (def SystemDefinition) service(name string) *Service {
+	for i := range def.Services {
+		if def.Services[i].Name == name {
+			return &def.Services[i]
+		}
+	}
+
+	return nil
+}
+
+// validateZones checks latencies of zones of def are set to other defined
+// zones and are not negative, every service of def is placed in a defined
+// zone, and calls zones of no more distinct latencies than the init container
+// has prio bands for.
+func validateZones(def SystemDefinition) error {
+	for _, zone := range def.Zones {
+		for to, latency := range zone.Latency {
+			if def.zone(to) == nil {
+				return fmt.Errorf("zone %q sets latency to unknown zone %q", zone.Name, to)
+			}
+			if latency < 0 {
+				return fmt.Errorf("zone %q sets negative latency %d to zone %q", zone.Name, latency, to)
+			}
+		}
+	}
+
+	for _, svc := range def.Services {
+		if svc.Zone == "" {
+			continue
+		}
+		if def.zone(svc.Zone) == nil {
+			return fmt.Errorf("service %q is placed in unknown zone %q", svc.Name, svc.Zone)
+		}
+
+		latencies := make(map[int]bool)
+		for _, call := range svc.Calls {
+			target := call.Name
+			if call.Async {
+				target = call.Broker
+			}
+			if callee := def.service(target); callee != nil && callee.Zone != "" {
+				if latency := def.latency(svc.Zone, callee.Zone); latency > 0 {
+					latencies[latency] = true
+				}
+			}
+		}
+		if tcDefaultBands+len(latencies) > tcMaxBands {
+			return fmt.Errorf("service %q calls zones of more than %d distinct latencies", svc.Name, tcMaxBands-tcDefaultBands)
+		}
+	}
+
+	return nil
+}
+
+// prepareZoneNodeSelector pins pods of svc on nodes of the topology zone its
+// zone is mapped to, if any.
+func prepareZoneNodeSelector(svc Service, def SystemDefinition) (map[string]string, error) {
+	if svc.Zone == "" {
+		return nil, nil
+	}
+
+	zone := def.zone(svc.Zone)
+	if zone == nil {
+		return nil, fmt.Errorf("service %q is placed in unknown zone %q", svc.Name, svc.Zone)
+	}
+	if zone.Topology == "" {
+		return nil, nil
+	}
+
+	return map[string]string{
+		topologyZoneLabel: zone.Topology,
+	}, nil
+}
+
+// prepareZoneInitContainers returns an init container delaying traffic from
+// pods of svc to callees in other zones. Traffic is matched by callee cluster
+// IPs, as it is not yet translated to pod IPs while leaving the pod. Only
+// egress is delayed, so a call takes the latency once per round trip. Mesh
+// sidecars connect to pod IPs instead, so their traffic is not delayed.
+func prepareZoneInitContainers(svc Service, def SystemDefinition) ([]apiv1.Container, error) {
+	if svc.Zone == "" {
+		return nil, nil
+	}
+
+	// Group callee cluster IPs by latency
+	destinations := make(map[int][]string)
+	for _, call := range svc.Calls {
+		target := call.Name
+		if call.Async {
+			target = call.Broker
+		}
+
+		callee := def.service(target)
+		if callee == nil || callee.Zone == "" {
+			// Callees of other systems or without zones are not delayed
+			continue
+		}
+		latency := def.latency(svc.Zone, callee.Zone)
+		clusterIP, ok := def.clusterIPs[target]
+		if latency <= 0 || !ok {
+			continue
+		}
+		destinations[latency] = append(destinations[latency], clusterIP)
+	}
+	if len(destinations) == 0 {
+		return nil, nil
+	}
+
+	latencies := make([]int, 0, len(destinations))
+	for latency := range destinations {
+		latencies = append(latencies, latency)
+	}
+	sort.Ints(latencies)
+	if tcDefaultBands+len(latencies) > tcMaxBands {
+		return nil, fmt.Errorf("service %q calls zones of more than %d distinct latencies", svc.Name, tcMaxBands-tcDefaultBands)
+	}
+
+	commands := []string{
+		fmt.Sprintf("tc qdisc add dev eth0 root handle 1: prio bands %d", tcDefaultBands+len(latencies)),
+	}
+	for i, latency := range latencies {
+		band := tcDefaultBands + i + 1
+		commands = append(commands, fmt.Sprintf("tc qdisc add dev eth0 parent 1:%d handle %d: netem delay %dms", band, band*10, latency))
+		for _, ip := range destinations[latency] {
+			commands = append(commands, fmt.Sprintf("tc filter add dev eth0 parent 1: protocol ip prio 1 u32 match ip dst %s/32 flowid 1:%d", ip, band))
+		}
+	}
+
+	return []apiv1.Container{
+		{
+			Name:    ZoneLatencyContainer,
+			Image:   tcImage,
+			Command: []string{"sh", "-c", strings.Join(commands, " && ")},
+			SecurityContext: &apiv1.SecurityContext{
+				Capabilities: &apiv1.Capabilities{
+					Add: []apiv1.Capability{
+						"NET_ADMIN",
+					},
+				},
+			},
+		},
+	}, nil
+}
+
+// decodeZoneDelays reverses prepareZoneInitContainers into the latency of
+// calls by callee cluster IP.
+func decodeZoneDelays(spec apiv1.PodSpec) map[string]int {
+	var command string
+	for _, container := range spec.InitContainers {
+		if container.Name == ZoneLatencyContainer {
+			command = strings.Join(container.Command, " ")
+		}
+	}
+	if command == "" {
+		return nil
+	}
+
+	latencies := make(map[string]int)
+	for _, match := range tcDelayPattern.FindAllStringSubmatch(command, -1) {
+		latencies[match[1]], _ = strconv.Atoi(match[2])
+	}
+	delays := make(map[string]int)
+	for _, match := range tcFilterPattern.FindAllStringSubmatch(command, -1) {
+		if latency, ok := latencies[match[2]]; ok {
+			delays[match[1]] = latency
+		}
+	}
+
+	return delays
+}
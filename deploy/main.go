@@ -2,16 +2,22 @@ package main
 
 import (
 	"vecro-sim/deploy/base"
+	"context"
 	"flag"
-	"io/ioutil"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	"fmt"
+	"k8s.io/client-go/dynamic"
 	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/rest"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
+	"log"
 	"os"
 	"path/filepath"
+	"strings"
 )
 
+var logger = log.New(os.Stderr, "", 0)
+
 func main() {
 	var kubeconfig *string
 	if home := homedir.HomeDir(); home != "" {
@@ -20,41 +26,199 @@ func main() {
 		kubeconfig = flag.String("kubeconfig", "", "absolute path to the kubeconfig file")
 	}
 
-	defFilePath := flag.String("deffile", "", "path to system definition file")
+	defFilePaths := files{}
+	flag.Var(&defFilePaths, "deffile", "path to system definition file (may be repeated to compose systems)")
+	vars := variables{}
+	flag.Var(vars, "set", "set variable of system definition in key=value form (may be repeated)")
+	updateWorkload := flag.Bool("update-workload", false, "update live workload of a deployed system instead of deploying it")
+	check := flag.Bool("check", false, "only check whether systems fit into the cluster without deploying them")
+	force := flag.Bool("force", false, "deploy systems even if they do not fit into the cluster")
+	diff := flag.Bool("diff", false, "compare deployed systems with their definitions instead of deploying them")
+	teardown := flag.Bool("teardown", false, "delete deployed systems instead of deploying them")
+	export := flag.String("export", "", "print definitions of systems deployed in given namespace instead of deploying them")
+	qps := flag.Float64("qps", 10, "maximum number of create requests per second")
+	workers := flag.Int("workers", 5, "number of concurrent create requests")
+	onError := flag.String("on-error", base.OnErrorRollback, "what to do with created resources when deployment fails: rollback or keep")
 
 	flag.Parse()
 
-	// Open & parse system definition file in YAML
-	defFile, err := os.Open(*defFilePath)
-	if err != nil {
-		panic(err)
+	if *onError != base.OnErrorRollback && *onError != base.OnErrorKeep {
+		logger.Fatalf("Unknown -on-error %q, expecting rollback or keep.", *onError)
+	}
+	if *export != "" {
+		exportDefinitions(context.TODO(), getClientset(*kubeconfig), getDynamicClient(*kubeconfig), *export)
+		return
+	}
+	if len(defFilePaths) == 0 {
+		panic("no system definition file given")
 	}
-	defer defFile.Close()
 
-	sysdefStr, _ := ioutil.ReadAll(defFile)
-	var sysdef base.SystemDefinition
-	err = yaml.Unmarshal(sysdefStr, &sysdef)
+	// Open & parse system definition files in YAML
+	sysdefs := make([]base.SystemDefinition, len(defFilePaths))
+	for i, path := range defFilePaths {
+		sysdef, err := base.LoadSystemDefinition(path, vars)
+		if err != nil {
+			panic(err)
+		}
+		sysdefs[i] = sysdef
+	}
+	sysdefs, err := base.Compose(sysdefs)
 	if err != nil {
 		panic(err)
 	}
 
 	// Connect to Kubernetes & deploy services
 	clientset := getClientset(*kubeconfig)
-	base.CreateResources(clientset, sysdef)
+	if *diff {
+		differences := 0
+		for _, sysdef := range sysdefs {
+			sysdefDifferences, err := base.Diff(context.TODO(), clientset, sysdef)
+			if err != nil {
+				logger.Fatal(err)
+			}
+			differences += sysdefDifferences
+		}
+		if differences > 0 {
+			os.Exit(1)
+		}
+		return
+	}
+	if *teardown {
+		dynamicClient := getDynamicClient(*kubeconfig)
+		for _, sysdef := range sysdefs {
+			if _, err := base.Teardown(context.TODO(), clientset, dynamicClient, sysdef); err != nil {
+				logger.Fatal(err)
+			}
+		}
+		return
+	}
+	if !*updateWorkload {
+		// Nodes & pods of the whole cluster may not be readable with
+		// namespaced permissions, which only -check requires
+		fits, err := base.CheckCapacity(context.TODO(), clientset, sysdefs)
+		if err != nil && *check {
+			logger.Fatal(err)
+		} else if err != nil {
+			logger.Printf("Warning: capacity could not be checked: %v.", err)
+			fits = true
+		}
+		if *check {
+			return
+		}
+		if !fits && !*force {
+			logger.Fatal("Deployment aborted, use -force to deploy anyway.")
+		}
+	}
+	opts := base.CreateOptions{
+		QPS:     float32(*qps),
+		Workers: *workers,
+		OnError: *onError,
+		Dynamic: getDynamicClient(*kubeconfig),
+	}
+	if *updateWorkload {
+		for _, sysdef := range sysdefs {
+			if err := base.UpdateWorkload(context.TODO(), clientset, sysdef); err != nil {
+				logger.Fatal(err)
+			}
+		}
+		return
+	}
+	// Systems composed are rolled back together
+	if _, err := base.DeployAll(context.TODO(), clientset, sysdefs, opts); err != nil {
+		logger.Fatal(err)
+	}
 }
 
-func getClientset(kubeconfig string) *kubernetes.Clientset {
+// exportDefinitions prints reconstructed definitions of systems in namespace
+// as a multi-document YAML.
+func exportDefinitions(ctx context.Context, clientset kubernetes.Interface, dynamicClient dynamic.Interface, namespace string) {
+	sysdefs, warnings, err := base.Export(ctx, clientset, dynamicClient, namespace)
+	if err != nil {
+		logger.Fatal(err)
+	}
+	for _, warning := range warnings {
+		logger.Printf("Warning: %s.", warning)
+	}
+	if len(sysdefs) == 0 {
+		logger.Fatalf("No system is deployed in namespace %q.", namespace)
+	}
+
+	for i, sysdef := range sysdefs {
+		defYAML, err := base.MarshalDefinition(sysdef)
+		if err != nil {
+			panic(err)
+		}
+		if i > 0 {
+			fmt.Println("---")
+		}
+		fmt.Print(string(defYAML))
+	}
+}
+
+func getConfig(kubeconfig string) *rest.Config {
 	// use the current context in kubeconfig
 	config, err := clientcmd.BuildConfigFromFlags("", kubeconfig)
 	if err != nil {
 		panic(err.Error())
 	}
+	// requests are throttled by -qps instead of the client-side default
+	config.QPS = 100
+	config.Burst = 200
+
+	return config
+}
 
+func getClientset(kubeconfig string) *kubernetes.Clientset {
 	// create the clientset
-	clientset, err := kubernetes.NewForConfig(config)
+	clientset, err := kubernetes.NewForConfig(getConfig(kubeconfig))
 	if err != nil {
 		panic(err.Error())
 	}
 
 	return clientset
 }
+
+// getDynamicClient returns the client of custom resources, such as those of
+// service meshes.
+func getDynamicClient(kubeconfig string) dynamic.Interface {
+	client, err := dynamic.NewForConfig(getConfig(kubeconfig))
+	if err != nil {
+		panic(err.Error())
+	}
+
+	return client
+}
+
+// variables collects repeated -set key=value flags.
+type variables map[string]string
+
+func (v variables) String() string {
+	pairs := make([]string, 0, len(v))
+	for key, value := range v {
+		pairs = append(pairs, key+"="+value)
+	}
+
+	return strings.Join(pairs, ",")
+}
+
+func (v variables) Set(pair string) error {
+	kv := strings.SplitN(pair, "=", 2)
+	if len(kv) != 2 || kv[0] == "" {
+		return fmt.Errorf("invalid variable %q, expecting key=value", pair)
+	}
+	v[kv[0]] = kv[1]
+
+	return nil
+}
+
+// files collects repeated -deffile flags.
+type files []string
+
+func (f *files) String() string {
+	return strings.Join(*f, ",")
+}
+
+func (f *files) Set(path string) error {
+	*f = append(*f, path)
+	return nil
+}
@@ -0,0 +1,74 @@
+package faults
+
+import (
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+)
+
+// KillPods deletes pods of target through the API, with gracePeriod if set.
+// Pods already gone are skipped.
+func KillPods(ctx context.Context,
+	clientset kubernetes.Interface,
+	target Target,
+	gracePeriod *metav1.Duration) error {
+	options := metav1.DeleteOptions{}
+	if gracePeriod != nil {
+		seconds := int64(gracePeriod.Duration.Seconds())
+		options.GracePeriodSeconds = &seconds
+	}
+
+	podsClient := clientset.CoreV1().Pods(target.Namespace)
+	for _, pod := range target.Pods {
+		err := podsClient.Delete(ctx, pod, options)
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		fmt.Printf("Killed pod %q.\n", pod)
+	}
+
+	return nil
+}
+
+// AddContainerKill kills target containers with signal, after which kubelet
+// restarts them.
+func AddContainerKill(pod *apiv1.PodSpec,
+	name string,
+	target Target,
+	signal string) {
+	appendContainer(pod, *newPumbaContainer(name+"-container-kill", pumbaArgs(target,
+		"kill",
+		"--signal",
+		signal,
+	), nil))
+}
+
+// AddPause freezes every process of target containers for duration.
+func AddPause(pod *apiv1.PodSpec,
+	name string,
+	target Target,
+	duration metav1.Duration) {
+	appendContainer(pod, *newPumbaContainer(name+"-pause", pumbaArgs(target,
+		"pause",
+		"--duration",
+		duration.Duration.String(),
+	), nil))
+}
+
+// AddStop stops target containers gracefully, with SIGTERM followed by SIGKILL
+// after a grace period, and restarts them after duration. Kubelet may restart
+// them earlier on its own.
+func AddStop(pod *apiv1.PodSpec,
+	name string,
+	target Target,
+	duration metav1.Duration) {
+	appendContainer(pod, *newPumbaContainer(name+"-stop", pumbaArgs(target,
+		"stop",
+		"--restart",
+		"--duration",
+		duration.Duration.String(),
+	), nil))
+}
@@ -1,7 +1,6 @@
 package faults
 
 import (
-	"fmt"
 	apiv1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"strconv"
@@ -11,15 +10,11 @@ const tcImage = "gaiadocker/iproute2"
 
 func AddNetDelay(pod *apiv1.PodSpec,
 	name string,
-	target string,
+	target Target,
 	delay metav1.Duration,
 	jitter metav1.Duration,
 	duration metav1.Duration) {
-	appendContainer(pod, *newPumbaContainer(name+"-net-delay", []string{
-		"--log-level",
-		"info",
-		"--label",
-		fmt.Sprintf("io.kubernetes.container.name=%s", target),
+	appendContainer(pod, *newPumbaContainer(name+"-net-delay", pumbaArgs(target,
 		"netem",
 		"--duration",
 		duration.Duration.String(),
@@ -30,21 +25,17 @@ func AddNetDelay(pod *apiv1.PodSpec,
 		strconv.FormatInt(delay.Milliseconds(), 10),
 		"--jitter",
 		strconv.FormatInt(jitter.Milliseconds(), 10),
-	}, []apiv1.Capability{
+	), []apiv1.Capability{
 		"NET_ADMIN",
 	}))
 }
 
 func AddNetLoss(pod *apiv1.PodSpec,
 	name string,
-	target string,
+	target Target,
 	percent int,
 	duration metav1.Duration) {
-	appendContainer(pod, *newPumbaContainer(name+"-net-loss", []string{
-		"--log-level",
-		"info",
-		"--label",
-		fmt.Sprintf("io.kubernetes.container.name=%s", target),
+	appendContainer(pod, *newPumbaContainer(name+"-net-loss", pumbaArgs(target,
 		"netem",
 		"--duration",
 		duration.Duration.String(),
@@ -53,21 +44,17 @@ func AddNetLoss(pod *apiv1.PodSpec,
 		"loss",
 		"--percent",
 		strconv.Itoa(percent),
-	}, []apiv1.Capability{
+	), []apiv1.Capability{
 		"NET_ADMIN",
 	}))
 }
 
 func AddNetRate(pod *apiv1.PodSpec,
 	name string,
-	target string,
+	target Target,
     rate string,
 	duration metav1.Duration) {
-	appendContainer(pod, *newPumbaContainer(name+"-net-rate", []string{
-		"--log-level",
-		"info",
-		"--label",
-		fmt.Sprintf("io.kubernetes.container.name=%s", target),
+	appendContainer(pod, *newPumbaContainer(name+"-net-rate", pumbaArgs(target,
 		"netem",
 		"--duration",
 		duration.Duration.String(),
@@ -76,7 +63,7 @@ func AddNetRate(pod *apiv1.PodSpec,
 		"rate",
 		"--rate",
 		rate,
-	}, []apiv1.Capability{
+	), []apiv1.Capability{
 		"NET_ADMIN",
 	}))
 }
\ No newline at end of file
@@ -8,45 +8,81 @@ import (
 
 func AddCPUStress(pod *apiv1.PodSpec,
 	name string,
-	target string,
+	target Target,
 	load int,
 	method string,
 	duration metav1.Duration) {
-	appendContainer(pod, *newPumbaContainer(name+"-cpu-stress", []string{
-		"--log-level",
-		"info",
-		"--label",
-		fmt.Sprintf("io.kubernetes.container.name=%s", target),
+	appendContainer(pod, *newPumbaContainer(name+"-cpu-stress", pumbaArgs(target,
 		"stress",
 		"--duration",
 		duration.Duration.String(),
 		"--stressors",
 		fmt.Sprintf("\"--cpus 1 --cpu-load %d --cpu-method %s\"", load, method),
-	}, nil))
+	), nil))
 }
 
-func AddIOStress(pod *apiv1.PodSpec,
+// AddMemStress allocates bytes of memory by every one of workers, in the cgroup
+// of target containers.
+func AddMemStress(pod *apiv1.PodSpec,
 	name string,
-	target string,
+	target Target,
+	workers int,
+	bytes int64,
 	method string,
 	duration metav1.Duration) {
-	var stressors string
-	if method == "sync" {
-		stressors = fmt.Sprintf("\"--io 1\"")
-	} else if method == "iomix" {
-		stressors = fmt.Sprintf("\"--iomix 1\"")
-	} else {
-		panic("invalid IO stress method is specified.\nSupported options: sync, iomix.")
+	appendContainer(pod, *newPumbaContainer(name+"-mem-stress", pumbaArgs(target,
+		"stress",
+		"--duration",
+		duration.Duration.String(),
+		"--stressors",
+		fmt.Sprintf("\"--vm %d --vm-bytes %d --vm-method %s\"", workers, bytes, method),
+	), nil))
+}
+
+// AddMemLeak allocates bytes of memory in the cgroup of target containers, and
+// keeps it until duration is over.
+func AddMemLeak(pod *apiv1.PodSpec,
+	name string,
+	target Target,
+	bytes int64,
+	duration metav1.Duration) {
+	appendContainer(pod, *newPumbaContainer(name+"-mem-leak", pumbaArgs(target,
+		"stress",
+		"--duration",
+		duration.Duration.String(),
+		"--stressors",
+		fmt.Sprintf("\"--vm 1 --vm-bytes %d --vm-keep --vm-hang 0\"", bytes),
+	), nil))
+}
+
+// ioStressors are the stress-ng stressors of every IO stress method.
+var ioStressors = map[string]string{
+	"sync":  "\"--io 1\"",
+	"iomix": "\"--iomix 1\"",
+}
+
+// ValidateIOStressMethod checks method is one AddIOStress supports.
+func ValidateIOStressMethod(method string) error {
+	if _, ok := ioStressors[method]; !ok {
+		return fmt.Errorf("invalid IO stress method %q is specified.\nSupported options: sync, iomix", method)
 	}
-	appendContainer(pod, *newPumbaContainer(name+"-io-stress", []string{
-		"--log-level",
-		"info",
-		"--label",
-		fmt.Sprintf("io.kubernetes.container.name=%s", target),
+
+	return nil
+}
+
+// AddIOStress adds a container stressing IO of target by method, which has to
+// be checked by ValidateIOStressMethod first.
+func AddIOStress(pod *apiv1.PodSpec,
+	name string,
+	target Target,
+	method string,
+	duration metav1.Duration) {
+	stressors := ioStressors[method]
+	appendContainer(pod, *newPumbaContainer(name+"-io-stress", pumbaArgs(target,
 		"stress",
 		"--duration",
 		duration.Duration.String(),
 		"--stressors",
 		stressors,
-	}, nil))
+	), nil))
 }
\ No newline at end of file
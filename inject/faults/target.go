@@ -0,0 +1,66 @@
+package faults
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+// Target selects the containers a fault acts on.
+type Target struct {
+	Containers []string // Names of containers
+	Namespace  string   // Namespace of pods, any namespace if empty
+	Pods       []string // Names of pods, any pod if empty
+}
+
+// pumbaArgs returns arguments of pumba running command on containers of
+// target only.
+func pumbaArgs(target Target, command ...string) []string {
+	args := []string{
+		"--log-level",
+		"info",
+	}
+	if len(target.Containers) == 1 {
+		args = append(args, "--label", fmt.Sprintf("io.kubernetes.container.name=%s", target.Containers[0]))
+	}
+	if target.Namespace != "" {
+		args = append(args, "--label", fmt.Sprintf("io.kubernetes.pod.namespace=%s", target.Namespace))
+	}
+	args = append(args, command...)
+
+	return append(args, target.names()...)
+}
+
+// names returns the pattern matching docker container names of target,
+// which kubelet names k8s_<container>_<pod>_<namespace>_<uid>_<attempt>.
+// Docker reports names with a leading slash, which may or may not be kept.
+// Containers are matched by label instead if there is only one of any pod.
+func (t Target) names() []string {
+	if len(t.Pods) == 0 && len(t.Containers) == 1 {
+		return nil
+	}
+
+	namespace := "[^_]+"
+	if t.Namespace != "" {
+		namespace = regexp.QuoteMeta(t.Namespace)
+	}
+
+	return []string{
+		fmt.Sprintf("re2:^/?k8s_%s_%s_%s_", alternatives(t.Containers), alternatives(t.Pods), namespace),
+	}
+}
+
+// alternatives returns the pattern matching any of names, or any name if
+// there is none.
+func alternatives(names []string) string {
+	if len(names) == 0 {
+		return "[^_]+"
+	}
+
+	quoted := make([]string, len(names))
+	for i, name := range names {
+		quoted[i] = regexp.QuoteMeta(name)
+	}
+
+	return "(" + strings.Join(quoted, "|") + ")"
+}
@@ -0,0 +1,68 @@
+package faults
+
+import (
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+func TestPumbaArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		target Target
+		want   []string
+	}{
+		{"one container of any pod", Target{Containers: []string{"auth"}, Namespace: "social"}, []string{
+			"--log-level", "info",
+			"--label", "io.kubernetes.container.name=auth",
+			"--label", "io.kubernetes.pod.namespace=social",
+			"pause",
+		}},
+		{"one container of pods", Target{Containers: []string{"auth"}, Namespace: "social", Pods: []string{"auth-1", "auth-2"}}, []string{
+			"--log-level", "info",
+			"--label", "io.kubernetes.container.name=auth",
+			"--label", "io.kubernetes.pod.namespace=social",
+			"pause",
+			"re2:^/?k8s_(auth)_(auth-1|auth-2)_social_",
+		}},
+		{"several containers", Target{Containers: []string{"db-agent", "db-mongodb"}, Namespace: "social", Pods: []string{"db-0"}}, []string{
+			"--log-level", "info",
+			"--label", "io.kubernetes.pod.namespace=social",
+			"pause",
+			"re2:^/?k8s_(db-agent|db-mongodb)_(db-0)_social_",
+		}},
+		{"any namespace", Target{Containers: []string{"a.b"}, Pods: []string{"a.b-1"}}, []string{
+			"--log-level", "info",
+			"--label", "io.kubernetes.container.name=a.b",
+			"pause",
+			`re2:^/?k8s_(a\.b)_(a\.b-1)_[^_]+_`,
+		}},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := pumbaArgs(test.target, "pause"); !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got args %q, want %q", got, test.want)
+			}
+		})
+	}
+}
+
+func TestNamesMatchDockerNames(t *testing.T) {
+	target := Target{Containers: []string{"auth"}, Namespace: "social", Pods: []string{"auth-1"}}
+	pattern := regexp.MustCompile(strings.TrimPrefix(target.names()[0], "re2:"))
+	tests := []struct {
+		name  string
+		match bool
+	}{
+		{"k8s_auth_auth-1_social_0f1e_0", true},
+		{"/k8s_auth_auth-1_social_0f1e_0", true},
+		{"/k8s_auth_auth-2_social_0f1e_0", false},
+		{"/k8s_POD_auth-1_social_0f1e_0", false},
+	}
+	for _, test := range tests {
+		if got := pattern.MatchString(test.name); got != test.match {
+			t.Errorf("got %v matching %q, want %v", got, test.name, test.match)
+		}
+	}
+}
@@ -0,0 +1,470 @@
+package injector
+
+import (
+	"vecro-sim/deploy/base"
+	"vecro-sim/inject/faults"
+	"context"
+	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	clientbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const labelManagedBy = "vecro-sim"
+const annotationTargetPods = "vecro-sim/target-pods"
+
+// InjectResult describes faults injected by InjectFaults.
+type InjectResult struct {
+	Name      string
+	Namespace string
+	Injected  []InjectedFault
+	Statuses  map[string]string // Status of every fault by name
+}
+
+// jobAwaiter waits for job injecting fault to finish, and records its status &
+// window into fault.
+type jobAwaiter func(ctx context.Context, clientset kubernetes.Interface, namespace string, job *batchv1.Job, fault *InjectedFault) error
+
+// InjectedFault is a fault injected by a job, or through the API, into pods on
+// one node.
+type InjectedFault struct {
+	Fault  string
+	Job    string // Unset if injected through the API only
+	Node   string
+	Pods   []string // Pods affected by the fault
+	Time   time.Time
+	Status string     // JobSucceeded, JobFailed or JobCancelled
+	Reason string     // Reason of job failure, or ReasonOOMKilled
+	Start  *time.Time // When the fault actually started, if known
+	End    *time.Time // When the fault actually ended, if known
+}
+
+// FaultError is the failure to inject one fault.
+type FaultError struct {
+	Fault string
+	Err   error
+}
+
+func (e *FaultError) Error() string {
+	return fmt.Sprintf("fault %q: %v", e.Fault, e.Err)
+}
+
+func (e *FaultError) Unwrap() error {
+	return e.Err
+}
+
+// InjectError collects every fault failed to be injected.
+type InjectError struct {
+	Name   string
+	Errors []*FaultError
+}
+
+func (e *InjectError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, err := range e.Errors {
+		messages[i] = err.Error()
+	}
+
+	return fmt.Sprintf("failed to inject %d faults of %q: %s", len(e.Errors), e.Name, strings.Join(messages, "; "))
+}
+
+// InjectFaults injects every fault of fdef at its start, and returns once all
+// of them are finished. Faults not started yet when ctx is done are not
+// injected, and those running are cancelled. The error returned is an
+// *InjectError, including faults failed to run. Nothing is injected if any
+// fault is invalid.
+func InjectFaults(ctx context.Context, clientset kubernetes.Interface, fdef FaultDefinition) (*InjectResult, error) {
+	result := &InjectResult{
+		Name:      fdef.Name,
+		Namespace: fdef.Namespace,
+	}
+	errs := make([]*FaultError, 0)
+	for _, f := range fdef.Faults {
+		if err := f.validate(); err != nil {
+			errs = append(errs, &FaultError{Fault: f.Name, Err: err})
+		}
+	}
+	if len(errs) > 0 {
+		result.Statuses = summarize(fdef, nil, errs)
+		return result, &InjectError{Name: fdef.Name, Errors: errs}
+	}
+
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	for _, f := range fdef.Faults {
+		wg.Add(1)
+		go func(f Fault) {
+			defer wg.Done()
+			injected, err := singleFault(ctx, clientset, fdef, f)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, &FaultError{Fault: f.Name, Err: err})
+			}
+			result.Injected = append(result.Injected, injected...)
+		}(f)
+	}
+	wg.Wait()
+
+	sort.Slice(result.Injected, func(i, j int) bool {
+		return result.Injected[i].Time.Before(result.Injected[j].Time)
+	})
+	result.Statuses = summarize(fdef, result.Injected, errs)
+	if len(errs) > 0 {
+		return result, &InjectError{Name: fdef.Name, Errors: errs}
+	}
+
+	return result, nil
+}
+
+// validate checks options of f, which would otherwise fail only once f starts.
+func (f Fault) validate() error {
+	switch f.Container {
+	case base.ContainerMain, base.ContainerAgent, base.ContainerDB, base.ContainerAll:
+	default:
+		return fmt.Errorf("invalid container %q of target %q.\nSupported options: agent, db, all", f.Container, f.Target)
+	}
+	if f.Behaviors.IOStress.Method != "" {
+		if err := faults.ValidateIOStressMethod(f.Behaviors.IOStress.Method); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Horizon returns when the last fault of fdef is scheduled to end.
+func (fdef FaultDefinition) Horizon() time.Duration {
+	horizon := time.Duration(0)
+	for _, f := range fdef.Faults {
+		if end := f.Start.Duration + f.Duration.Duration; end > horizon {
+			horizon = end
+		}
+	}
+
+	return horizon
+}
+
+// summarize returns the status of every fault, which is the worst status of
+// its jobs: failed, cancelled, and then succeeded. Faults failed before any
+// job is created are failed as well.
+func summarize(fdef FaultDefinition, injected []InjectedFault, errs []*FaultError) map[string]string {
+	rank := map[string]int{JobSucceeded: 1, JobCancelled: 2, JobFailed: 3}
+	statuses := make(map[string]string, len(fdef.Faults))
+	for _, f := range fdef.Faults {
+		statuses[f.Name] = FaultNotInjected
+	}
+	for _, fault := range injected {
+		if rank[fault.Status] > rank[statuses[fault.Fault]] {
+			statuses[fault.Fault] = fault.Status
+		}
+	}
+	for _, err := range errs {
+		statuses[err.Fault] = JobFailed
+	}
+
+	return statuses
+}
+
+// singleFault injects f at its start into pods of its target, with a job on
+// every node they run on, and waits for the jobs to finish. Nothing is
+// injected if ctx is done before.
+func singleFault(ctx context.Context, clientset kubernetes.Interface, fdef FaultDefinition, f Fault) ([]InjectedFault, error) {
+	namespace := fdef.Namespace
+	t := time.NewTimer(f.Start.Duration)
+	defer t.Stop()
+	fmt.Printf("Pending fault %s will be injected in %s.\n", f.Name, f.Start.Duration.String())
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+		fmt.Printf("Pending fault %s is not injected.\n", f.Name)
+		return nil, nil
+	}
+
+	// Pods are resolved on start, as they may have been rescheduled since
+	targets, err := resolveTargets(ctx, clientset, fdef, f)
+	if err != nil {
+		return nil, err
+	}
+	nodes := make([]string, 0, len(targets))
+	for node := range targets {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+
+	injected := make([]InjectedFault, 0, len(targets))
+	if f.Behaviors.PodKill != nil {
+		killed, err := killPods(ctx, clientset, f, nodes, targets)
+		injected = append(injected, killed...)
+		if err != nil {
+			return injected, err
+		}
+	}
+	if !f.Behaviors.injectedByJob() && f.Behaviors.MemLeak == nil {
+		return injected, nil
+	}
+
+	// Every job is awaited as soon as it is created, so that failures are
+	// reported while others are still being created, and stop mem-leak ramps
+	jobsClient := clientset.BatchV1().Jobs(namespace)
+	jobFaults := make([]*InjectedFault, 0, len(targets))
+	failures := make([]string, 0)
+	stopped := make(chan struct{})
+	var stopOnce sync.Once
+	var mu sync.Mutex
+	var wg sync.WaitGroup
+	create := func(job *batchv1.Job, node string, await jobAwaiter) error {
+		result, err := createJob(ctx, jobsClient, job, node, targets[node].Pods)
+		if err != nil {
+			return err
+		}
+		fault := &InjectedFault{
+			Fault: f.Name,
+			Job:   result.Name,
+			Node:  node,
+			Pods:  targets[node].Pods,
+			Time:  result.CreationTimestamp.Time,
+		}
+		jobFaults = append(jobFaults, fault)
+
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			err := await(ctx, clientset, namespace, result, fault)
+			if err != nil || fault.Reason == ReasonOOMKilled {
+				stopOnce.Do(func() { close(stopped) })
+			}
+			if err != nil {
+				fmt.Printf("Fault %s on node %q failed: %v\n", f.Name, fault.Node, err)
+				mu.Lock()
+				failures = append(failures, err.Error())
+				mu.Unlock()
+			}
+		}()
+		return nil
+	}
+
+	// Jobs created are still awaited, or cancelled, if creating others fails
+	var createErr error
+	if f.Behaviors.injectedByJob() {
+		for _, node := range nodes {
+			if createErr = create(prepareJob(f, node, targets[node]), node, awaitJob); createErr != nil {
+				break
+			}
+		}
+	}
+	if f.Behaviors.MemLeak != nil && createErr == nil {
+		createErr = injectLeak(ctx, clientset, namespace, f, nodes, targets, create, stopped)
+	}
+	wg.Wait()
+
+	for _, fault := range jobFaults {
+		injected = append(injected, *fault)
+	}
+	if createErr != nil {
+		failures = append(failures, createErr.Error())
+	}
+	if len(failures) > 0 {
+		return injected, fmt.Errorf("%s", strings.Join(failures, "; "))
+	}
+
+	return injected, nil
+}
+
+// killPods deletes pods of targets on nodes in order, up to the count of
+// f if set.
+func killPods(ctx context.Context, clientset kubernetes.Interface, f Fault, nodes []string, targets map[string]faults.Target) ([]InjectedFault, error) {
+	remaining := f.Behaviors.PodKill.Count
+	injected := make([]InjectedFault, 0, len(nodes))
+	for _, node := range nodes {
+		target := targets[node]
+		if f.Behaviors.PodKill.Count > 0 {
+			if remaining == 0 {
+				break
+			}
+			if len(target.Pods) > remaining {
+				target.Pods = target.Pods[:remaining]
+			}
+			remaining -= len(target.Pods)
+		}
+
+		err := faults.KillPods(ctx, clientset, target, f.Behaviors.PodKill.GracePeriod)
+		now := time.Now()
+		fault := InjectedFault{
+			Fault:  f.Name,
+			Node:   node,
+			Pods:   target.Pods,
+			Time:   now,
+			Status: JobSucceeded,
+			Start:  &now,
+			End:    &now,
+		}
+		if err != nil {
+			fault.Status = JobFailed
+			fault.Reason = err.Error()
+			return append(injected, fault), err
+		}
+		injected = append(injected, fault)
+	}
+
+	return injected, nil
+}
+
+func createJob(ctx context.Context, jobsClient clientbatchv1.JobInterface, job *batchv1.Job, node string, pods []string) (*batchv1.Job, error) {
+	//fmt.Printf("%#v\n", job)
+	result, err := jobsClient.Create(ctx, job, metav1.CreateOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Printf("Created job %q on node %q affecting pods %s.\n", result.GetObjectMeta().GetName(), node, strings.Join(pods, ", "))
+	return result, nil
+}
+
+// prepareJob returns the job injecting f into target pods on node.
+func prepareJob(f Fault, node string, target faults.Target) *batchv1.Job {
+	pod := faults.NewPumbaPod()
+	pod.NodeName = node
+
+	if f.Behaviors.NetDelay.Time.Milliseconds() > 0 {
+		faults.AddNetDelay(pod,
+			f.Name,
+			target,
+			f.Behaviors.NetDelay.Time,
+			f.Behaviors.NetDelay.Jitter,
+			f.Duration)
+	}
+
+	if f.Behaviors.NetLoss.Percent > 0 {
+		faults.AddNetLoss(pod,
+			f.Name,
+			target,
+			f.Behaviors.NetLoss.Percent,
+			f.Duration)
+	}
+
+	if f.Behaviors.NetRate.Rate != "" {
+		faults.AddNetRate(pod,
+			f.Name,
+			target,
+			f.Behaviors.NetRate.Rate,
+			f.Duration)
+	}
+
+	if f.Behaviors.CPUStress.Load > 0 {
+		method := f.Behaviors.CPUStress.Method
+		if method == "" {
+			method = "all" // Defaults to use all cpu stressing methods sequentially
+		}
+		faults.AddCPUStress(pod,
+			f.Name,
+			target,
+			f.Behaviors.CPUStress.Load,
+			method,
+			f.Duration)
+	}
+
+	if !f.Behaviors.MemStress.Bytes.IsZero() {
+		workers := f.Behaviors.MemStress.Workers
+		if workers <= 0 {
+			workers = 1
+		}
+		method := f.Behaviors.MemStress.Method
+		if method == "" {
+			method = "all"
+		}
+		faults.AddMemStress(pod,
+			f.Name,
+			target,
+			workers,
+			f.Behaviors.MemStress.Bytes.Value(),
+			method,
+			f.Duration)
+	}
+
+	if f.Behaviors.IOStress.Method != "" {
+		faults.AddIOStress(pod,
+			f.Name,
+			target,
+			f.Behaviors.IOStress.Method,
+			f.Duration)
+	}
+
+	if f.Behaviors.ContainerKill != nil {
+		signal := f.Behaviors.ContainerKill.Signal
+		if signal == "" {
+			signal = "SIGKILL"
+		}
+		faults.AddContainerKill(pod,
+			f.Name,
+			target,
+			signal)
+	}
+
+	if f.Behaviors.Pause != nil {
+		faults.AddPause(pod,
+			f.Name,
+			target,
+			f.Duration)
+	}
+
+	if f.Behaviors.Stop != nil {
+		faults.AddStop(pod,
+			f.Name,
+			target,
+			f.Duration)
+	}
+
+	return newJob(f, target, pod)
+}
+
+// newJob returns the job of f running pod against target pods.
+func newJob(f Fault, target faults.Target, pod *apiv1.PodSpec) *batchv1.Job {
+	return &batchv1.Job{
+		ObjectMeta: metav1.ObjectMeta{
+			// Use GenerateName Field to make name unique for every job.
+			GenerateName: fmt.Sprintf("%s-", f.Name),
+			//Name:      f.Name,
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       f.Name,
+				"app.kubernetes.io/managed-by": labelManagedBy,
+			},
+			Annotations: map[string]string{
+				annotationTargetPods: strings.Join(target.Pods, ","),
+			},
+		},
+		Spec: batchv1.JobSpec{
+			// Retrying would inject the fault once more
+			BackoffLimit:            int32Ptr(0),
+			TTLSecondsAfterFinished: int32Ptr(jobTTL),
+			ActiveDeadlineSeconds:   int64Ptr(int64((f.Duration.Duration + jobDeadlineMargin).Seconds())),
+			// Selector for a job is not necessary.
+			//Selector: &metav1.LabelSelector{
+			//	MatchLabels: map[string]string{
+			//		"app.kubernetes.io/name": f.Name,
+			//	},
+			//},
+			Template: apiv1.PodTemplateSpec{
+				ObjectMeta: metav1.ObjectMeta{
+					Name:      f.Name,
+					Labels: map[string]string{
+						"app.kubernetes.io/name":       f.Name,
+						"app.kubernetes.io/managed-by": labelManagedBy,
+					},
+				},
+				Spec: *pod,
+			},
+		},
+	}
+}
+
+func int32Ptr(i int32) *int32 { return &i }
+
+func int64Ptr(i int64) *int64 { return &i }
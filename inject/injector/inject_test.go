@@ -0,0 +1,213 @@
+package injector
+
+import (
+	"context"
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"vecro-sim/inject/faults"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func duration(d time.Duration) metav1.Duration {
+	return metav1.Duration{Duration: d}
+}
+
+func TestHorizon(t *testing.T) {
+	tests := []struct {
+		name   string
+		faults []Fault
+		want   time.Duration
+	}{
+		{"none", nil, 0},
+		{"one", []Fault{{Start: duration(time.Minute), Duration: duration(30 * time.Second)}}, 90 * time.Second},
+		{"last ending", []Fault{
+			{Start: duration(4 * time.Minute), Duration: duration(10 * time.Second)},
+			{Start: duration(time.Minute), Duration: duration(5 * time.Minute)},
+		}, 6 * time.Minute},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if got := (FaultDefinition{Faults: test.faults}).Horizon(); got != test.want {
+				t.Errorf("got horizon %s, want %s", got, test.want)
+			}
+		})
+	}
+}
+
+func TestSummarize(t *testing.T) {
+	fdef := FaultDefinition{Faults: []Fault{{Name: "a"}, {Name: "b"}, {Name: "c"}, {Name: "d"}}}
+	injected := []InjectedFault{
+		{Fault: "a", Status: JobSucceeded},
+		{Fault: "a", Status: JobFailed},
+		{Fault: "a", Status: JobCancelled},
+		{Fault: "b", Status: JobSucceeded},
+		{Fault: "b", Status: JobCancelled},
+	}
+	errs := []*FaultError{{Fault: "c"}}
+
+	want := map[string]string{
+		"a": JobFailed,
+		"b": JobCancelled,
+		"c": JobFailed,
+		"d": FaultNotInjected,
+	}
+	if got := summarize(fdef, injected, errs); !reflect.DeepEqual(got, want) {
+		t.Errorf("got statuses %v, want %v", got, want)
+	}
+}
+
+func TestJobFinished(t *testing.T) {
+	condition := func(conditionType batchv1.JobConditionType, reason string) batchv1.Job {
+		return batchv1.Job{Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+			{Type: conditionType, Status: apiv1.ConditionTrue, Reason: reason},
+		}}}
+	}
+	tests := []struct {
+		name      string
+		job       batchv1.Job
+		finished  bool
+		succeeded bool
+		reason    string
+	}{
+		{"running", batchv1.Job{}, false, false, ""},
+		{"complete", condition(batchv1.JobComplete, ""), true, true, ""},
+		{"failed", condition(batchv1.JobFailed, "BackoffLimitExceeded"), true, false, "BackoffLimitExceeded"},
+		{"deadline exceeded", condition(batchv1.JobFailed, "DeadlineExceeded"), true, false, "DeadlineExceeded"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			finished, succeeded, reason := jobFinished(&test.job)
+			if finished != test.finished || succeeded != test.succeeded || !strings.HasPrefix(reason, test.reason) {
+				t.Errorf("got %v, %v, %q, want %v, %v, %q", finished, succeeded, reason, test.finished, test.succeeded, test.reason)
+			}
+		})
+	}
+}
+
+func TestPrepareJobDeadline(t *testing.T) {
+	f := Fault{Name: "f", Duration: duration(time.Minute)}
+	f.Behaviors.CPUStress.Load = 50
+	job := prepareJob(f, "node", faults.Target{Containers: []string{"svc"}, Pods: []string{"pod"}})
+
+	want := int64((time.Minute + jobDeadlineMargin).Seconds())
+	if job.Spec.ActiveDeadlineSeconds == nil || *job.Spec.ActiveDeadlineSeconds != want {
+		t.Errorf("got deadline %v, want %d seconds", job.Spec.ActiveDeadlineSeconds, want)
+	}
+}
+
+func TestPrepareJobDefaultsCPUStressMethod(t *testing.T) {
+	f := Fault{Name: "f", Duration: duration(time.Minute)}
+	f.Behaviors.CPUStress.Load = 50
+	job := prepareJob(f, "node", faults.Target{Containers: []string{"svc"}, Pods: []string{"pod"}})
+
+	args := strings.Join(job.Spec.Template.Spec.Containers[0].Args, " ")
+	if !strings.Contains(args, "--cpu-method all") {
+		t.Errorf("got args %q, want cpu method all", args)
+	}
+}
+
+func TestPrepareJobStopsForDuration(t *testing.T) {
+	f := Fault{Name: "f", Duration: duration(time.Minute)}
+	f.Behaviors.Stop = &Stop{}
+	job := prepareJob(f, "node", faults.Target{Containers: []string{"svc"}, Pods: []string{"pod"}})
+
+	args := strings.Join(job.Spec.Template.Spec.Containers[0].Args, " ")
+	if !strings.Contains(args, "stop --restart --duration 1m0s") {
+		t.Errorf("got args %q, want stop for 1m0s", args)
+	}
+}
+
+func TestInjectFaultsKillsPods(t *testing.T) {
+	clientset := fake.NewSimpleClientset(
+		targetPod("a-auth-1", "a", "node-1"),
+		targetPod("b-auth-1", "b", "node-1"),
+		targetPod("b-auth-2", "b", "node-2"),
+	)
+	f := Fault{Name: "kill", Target: "auth"}
+	f.Behaviors.PodKill = &PodKill{Count: 1}
+	fdef := FaultDefinition{Name: "test", Namespace: "shared", System: "b", Faults: []Fault{f}}
+
+	result, err := InjectFaults(context.Background(), clientset, fdef)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Statuses["kill"] != JobSucceeded || len(result.Injected) != 1 {
+		t.Fatalf("got statuses %v & %d injected, want kill succeeded once", result.Statuses, len(result.Injected))
+	}
+
+	pods, err := clientset.CoreV1().Pods("shared").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := make([]string, 0)
+	for _, pod := range pods.Items {
+		left = append(left, pod.Name)
+	}
+	if want := []string{"a-auth-1", "b-auth-2"}; !reflect.DeepEqual(left, want) {
+		t.Errorf("got pods %v left, want %v", left, want)
+	}
+}
+
+func TestInjectFaultsRejectsInvalidFaults(t *testing.T) {
+	clientset := fake.NewSimpleClientset(targetPod("a-auth-1", "a", "node-1"))
+	kill := Fault{Name: "kill", Target: "auth"}
+	kill.Behaviors.PodKill = &PodKill{}
+	stress := Fault{Name: "stress", Target: "auth"}
+	stress.Behaviors.IOStress.Method = "async"
+	wrongContainer := Fault{Name: "wrong-container", Target: "auth", Container: "sidecar"}
+	fdef := FaultDefinition{Name: "test", Namespace: "shared", Faults: []Fault{kill, stress, wrongContainer}}
+
+	result, err := InjectFaults(context.Background(), clientset, fdef)
+	var injectErr *InjectError
+	if !errors.As(err, &injectErr) || len(injectErr.Errors) != 2 {
+		t.Fatalf("got error %v, want *InjectError of 2 faults", err)
+	}
+	want := map[string]string{
+		"kill":            FaultNotInjected,
+		"stress":          JobFailed,
+		"wrong-container": JobFailed,
+	}
+	if !reflect.DeepEqual(result.Statuses, want) {
+		t.Errorf("got statuses %v, want %v", result.Statuses, want)
+	}
+
+	pods, err := clientset.CoreV1().Pods("shared").List(context.Background(), metav1.ListOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pods.Items) != 1 {
+		t.Errorf("got %d pods left, want 1", len(pods.Items))
+	}
+}
+
+func TestLoadFaultDefinitionRequiresNamespace(t *testing.T) {
+	tests := []struct {
+		name  string
+		yaml  string
+		valid bool
+	}{
+		{"namespace", "name: test\nnamespace: social\n", true},
+		{"no namespace", "name: test\n", false},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), "faults.yaml")
+			if err := os.WriteFile(path, []byte(test.yaml), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if _, err := LoadFaultDefinition(path); (err == nil) != test.valid {
+				t.Errorf("got error %v, want valid %v", err, test.valid)
+			}
+		})
+	}
+}
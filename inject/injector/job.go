@@ -0,0 +1,141 @@
+package injector
+
+import (
+	"context"
+	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/fields"
+	"k8s.io/apimachinery/pkg/watch"
+	"k8s.io/client-go/kubernetes"
+	clientbatchv1 "k8s.io/client-go/kubernetes/typed/batch/v1"
+	"time"
+)
+
+// Statuses of fault jobs, and faults as well.
+const (
+	JobSucceeded = "Succeeded"
+	JobFailed    = "Failed"
+	JobCancelled = "Cancelled" // Deleted as injection is cancelled
+
+	FaultNotInjected = "NotInjected" // Not started as injection is cancelled
+)
+
+// ReasonOOMKilled is the reason of mem-leak jobs succeeding as their target
+// containers are OOMKilled, which is what mem-leak is meant to cause.
+const ReasonOOMKilled = "TargetOOMKilled"
+
+// jobTTL is how long finished jobs are kept before being garbage collected,
+// long enough to inspect logs of failed pumba pods.
+const jobTTL = 5 * 60
+
+// jobDeadlineMargin is how long jobs may run beyond the fault duration, long
+// enough to pull the pumba image, before they are failed as DeadlineExceeded.
+// Jobs stuck pending would hang injection forever otherwise.
+const jobDeadlineMargin = 5 * time.Minute
+
+// awaitJob waits for job injecting fault to finish, and records its status &
+// window into fault. Jobs still running when ctx is done are deleted, so that
+// pumba stops and reverts the fault immediately.
+func awaitJob(ctx context.Context, clientset kubernetes.Interface, namespace string, job *batchv1.Job, fault *InjectedFault) error {
+	jobsClient := clientset.BatchV1().Jobs(namespace)
+	succeeded, reason, err := watchJob(ctx, jobsClient, job)
+
+	// The context of injection may be done, so the rest runs with its own
+	window := func() {
+		fault.Start, fault.End, _ = jobWindow(context.Background(), clientset, namespace, job.Name)
+	}
+	if err != nil && ctx.Err() != nil {
+		window()
+		if fault.Start != nil && fault.End == nil {
+			// The fault ends as the job is deleted
+			now := time.Now()
+			fault.End = &now
+		}
+		fault.Status = JobCancelled
+		propagation := metav1.DeletePropagationForeground
+		err := jobsClient.Delete(context.Background(), job.Name, metav1.DeleteOptions{
+			PropagationPolicy: &propagation,
+		})
+		if err != nil && !errors.IsNotFound(err) {
+			return err
+		}
+		fmt.Printf("Deleted job %q.\n", job.Name)
+		return nil
+	} else if err != nil {
+		return err
+	}
+
+	window()
+	if !succeeded {
+		fault.Status = JobFailed
+		fault.Reason = reason
+		return fmt.Errorf("job %q failed: %s", job.Name, reason)
+	}
+	fault.Status = JobSucceeded
+	fmt.Printf("Job %q succeeded.\n", job.Name)
+
+	return nil
+}
+
+// watchJob watches job until it finishes, and returns whether it succeeded
+// along with the reason if not.
+func watchJob(ctx context.Context, jobsClient clientbatchv1.JobInterface, job *batchv1.Job) (bool, string, error) {
+	for {
+		if finished, succeeded, reason := jobFinished(job); finished {
+			return succeeded, reason, nil
+		}
+
+		w, err := jobsClient.Watch(ctx, metav1.ListOptions{
+			FieldSelector:   fields.OneTermEqualSelector("metadata.name", job.Name).String(),
+			ResourceVersion: job.ResourceVersion,
+		})
+		if err != nil {
+			return false, "", err
+		}
+		for event := range w.ResultChan() {
+			if event.Type == watch.Deleted {
+				w.Stop()
+				return false, "", fmt.Errorf("job %q is deleted", job.Name)
+			}
+			if updated, ok := event.Object.(*batchv1.Job); ok && updated.Name == job.Name {
+				job = updated
+			}
+			if finished, _, _ := jobFinished(job); finished || event.Type == watch.Error {
+				w.Stop()
+			}
+		}
+		if ctx.Err() != nil {
+			return false, "", ctx.Err()
+		}
+
+		// Watches expire, so the job is got again before watching again
+		if finished, _, _ := jobFinished(job); !finished {
+			job, err = jobsClient.Get(ctx, job.Name, metav1.GetOptions{})
+			if err != nil {
+				return false, "", err
+			}
+		}
+	}
+}
+
+// jobFinished returns whether job finished, and whether it succeeded along with
+// the reason if not.
+func jobFinished(job *batchv1.Job) (bool, bool, string) {
+	for _, condition := range job.Status.Conditions {
+		if condition.Status != apiv1.ConditionTrue {
+			continue
+		}
+
+		switch condition.Type {
+		case batchv1.JobComplete:
+			return true, true, ""
+		case batchv1.JobFailed:
+			return true, false, fmt.Sprintf("%s: %s", condition.Reason, condition.Message)
+		}
+	}
+
+	return false, false, ""
+}
@@ -0,0 +1,182 @@
+package injector
+
+import (
+	"vecro-sim/inject/faults"
+	"context"
+	"fmt"
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"time"
+)
+
+// leakSteps is how many steps mem-leak ramps up memory allocated in.
+const leakSteps = 5
+
+// injectLeak ramps up memory allocated in target containers of f over its
+// duration. Every step allocates another share of the bytes of f with a job
+// on every node, which is kept until f ends. Steps not started yet when ctx is
+// done, or stopped is closed as a job failed or its target is OOMKilled, are
+// not injected.
+func injectLeak(ctx context.Context, clientset kubernetes.Interface, namespace string, f Fault, nodes []string, targets map[string]faults.Target, create func(*batchv1.Job, string, jobAwaiter) error, stopped <-chan struct{}) error {
+	bytes, err := leakBytes(ctx, clientset, namespace, f, targets)
+	if err != nil {
+		return err
+	}
+
+	step := f.Duration.Duration / leakSteps
+	for i := 0; i < leakSteps; i++ {
+		if i > 0 {
+			t := time.NewTimer(step)
+			select {
+			case <-t.C:
+			case <-ctx.Done():
+				t.Stop()
+				return nil
+			case <-stopped:
+				t.Stop()
+				fmt.Printf("Fault %s stopped leaking memory after %d of %d steps.\n", f.Name, i, leakSteps)
+				return nil
+			}
+		}
+
+		remaining := metav1.Duration{Duration: f.Duration.Duration - time.Duration(i)*step}
+		for _, node := range nodes {
+			job := prepareLeakJob(f, node, targets[node], bytes, remaining)
+			if err := create(job, node, awaitLeakJob(targets[node].Containers)); err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// leakBytes returns the bytes leaked into every target container of f, which
+// are the memory limit of the container unless set by f.
+func leakBytes(ctx context.Context, clientset kubernetes.Interface, namespace string, f Fault, targets map[string]faults.Target) (map[string]int64, error) {
+	bytes := make(map[string]int64)
+	if f.Behaviors.MemLeak.Bytes != nil {
+		for _, target := range targets {
+			for _, container := range target.Containers {
+				bytes[container] = f.Behaviors.MemLeak.Bytes.Value()
+			}
+		}
+		return bytes, nil
+	}
+
+	// The lowest limit of pods is taken, as they may be of different versions
+	limits := make(map[string]int64)
+	podsClient := clientset.CoreV1().Pods(namespace)
+	for _, target := range targets {
+		for _, name := range target.Pods {
+			pod, err := podsClient.Get(ctx, name, metav1.GetOptions{})
+			if err != nil {
+				return nil, err
+			}
+			for _, container := range pod.Spec.Containers {
+				limit, ok := container.Resources.Limits[apiv1.ResourceMemory]
+				if !ok {
+					continue
+				}
+				if current, ok := limits[container.Name]; !ok || limit.Value() < current {
+					limits[container.Name] = limit.Value()
+				}
+			}
+		}
+	}
+
+	for _, target := range targets {
+		for _, container := range target.Containers {
+			limit, ok := limits[container]
+			if !ok {
+				return nil, fmt.Errorf("container %q of target %q has no memory limit, so bytes of mem-leak have to be set", container, f.Target)
+			}
+			bytes[container] = limit
+		}
+	}
+
+	return bytes, nil
+}
+
+// awaitLeakJob returns the awaiter of mem-leak jobs into containers, which
+// awaits them like awaitJob. Jobs failed as their target containers are
+// OOMKilled meanwhile succeed instead, with ReasonOOMKilled.
+func awaitLeakJob(containers []string) jobAwaiter {
+	return func(ctx context.Context, clientset kubernetes.Interface, namespace string, job *batchv1.Job, fault *InjectedFault) error {
+		err := awaitJob(ctx, clientset, namespace, job, fault)
+		if err == nil || fault.Status != JobFailed {
+			return err
+		}
+
+		// The context of injection may be done, so the rest runs with its own
+		killed, checkErr := oomKilled(context.Background(), clientset, namespace, fault.Pods, containers, job.CreationTimestamp.Time)
+		if checkErr != nil || !killed {
+			return err
+		}
+		fault.Status = JobSucceeded
+		fault.Reason = ReasonOOMKilled
+		fmt.Printf("Job %q succeeded as its target is OOMKilled.\n", job.Name)
+		return nil
+	}
+}
+
+// oomKilled returns whether any of containers of pods has been OOMKilled since.
+// Pods gone are skipped.
+func oomKilled(ctx context.Context, clientset kubernetes.Interface, namespace string, pods []string, containers []string, since time.Time) (bool, error) {
+	podsClient := clientset.CoreV1().Pods(namespace)
+	for _, name := range pods {
+		pod, err := podsClient.Get(ctx, name, metav1.GetOptions{})
+		if errors.IsNotFound(err) {
+			continue
+		} else if err != nil {
+			return false, err
+		}
+
+		for _, status := range pod.Status.ContainerStatuses {
+			if !contains(containers, status.Name) {
+				continue
+			}
+			for _, terminated := range []*apiv1.ContainerStateTerminated{status.State.Terminated, status.LastTerminationState.Terminated} {
+				if terminated != nil && terminated.Reason == "OOMKilled" && !terminated.FinishedAt.Time.Before(since) {
+					return true, nil
+				}
+			}
+		}
+	}
+
+	return false, nil
+}
+
+func contains(names []string, name string) bool {
+	for _, n := range names {
+		if n == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// prepareLeakJob returns the job of one step of mem-leak of f into target pods
+// on node, allocating a share of bytes of every container until duration is
+// over.
+func prepareLeakJob(f Fault, node string, target faults.Target, bytes map[string]int64, duration metav1.Duration) *batchv1.Job {
+	pod := faults.NewPumbaPod()
+	pod.NodeName = node
+
+	// Containers are stressed separately, as their bytes may differ
+	for i, container := range target.Containers {
+		single := target
+		single.Containers = []string{container}
+		faults.AddMemLeak(pod,
+			fmt.Sprintf("%s-%d", f.Name, i),
+			single,
+			bytes[container]/leakSteps,
+			duration)
+	}
+
+	return newJob(f, target, pod)
+}
@@ -0,0 +1,57 @@
+package injector
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	batchv1 "k8s.io/api/batch/v1"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func TestAwaitLeakJob(t *testing.T) {
+	created := time.Now().Add(-time.Minute)
+	terminated := func(reason string, finished time.Time) apiv1.ContainerState {
+		return apiv1.ContainerState{Terminated: &apiv1.ContainerStateTerminated{
+			Reason:     reason,
+			FinishedAt: metav1.NewTime(finished),
+		}}
+	}
+	tests := []struct {
+		name   string
+		state  apiv1.ContainerState
+		status string
+		reason string
+		failed bool
+	}{
+		{"running", apiv1.ContainerState{Running: &apiv1.ContainerStateRunning{}}, JobFailed, "Failed", true},
+		{"oom killed", terminated("OOMKilled", time.Now()), JobSucceeded, ReasonOOMKilled, false},
+		{"oom killed before", terminated("OOMKilled", created.Add(-time.Minute)), JobFailed, "Failed", true},
+		{"errored", terminated("Error", time.Now()), JobFailed, "Failed", true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(&apiv1.Pod{
+				ObjectMeta: metav1.ObjectMeta{Name: "pod", Namespace: "ns"},
+				Status: apiv1.PodStatus{ContainerStatuses: []apiv1.ContainerStatus{
+					{Name: "svc", LastTerminationState: test.state},
+				}},
+			})
+			job := &batchv1.Job{
+				ObjectMeta: metav1.ObjectMeta{Name: "job", Namespace: "ns", CreationTimestamp: metav1.NewTime(created)},
+				Status: batchv1.JobStatus{Conditions: []batchv1.JobCondition{
+					{Type: batchv1.JobFailed, Status: apiv1.ConditionTrue, Reason: "Failed"},
+				}},
+			}
+			fault := &InjectedFault{Fault: "leak", Job: "job", Pods: []string{"pod"}}
+
+			err := awaitLeakJob([]string{"svc"})(context.Background(), clientset, "ns", job, fault)
+			if (err != nil) != test.failed || fault.Status != test.status || !strings.HasPrefix(fault.Reason, test.reason) {
+				t.Errorf("got error %v, status %q & reason %q, want failed %v, status %q & reason %q", err, fault.Status, fault.Reason, test.failed, test.status, test.reason)
+			}
+		})
+	}
+}
@@ -0,0 +1,108 @@
+package injector
+
+import (
+	"errors"
+	"io/ioutil"
+	"k8s.io/apimachinery/pkg/api/resource"
+	v1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/util/yaml"
+)
+
+type FaultDefinition struct {
+	Name string `json:"name"`
+	Namespace string `json:"namespace"` // Namespace of target pods, in which jobs are created as well
+	System string `json:"system"` // System of target services, required if systems share the namespace
+	Faults []Fault `json:"faults"`
+}
+
+// LoadFaultDefinition opens & parses the fault definition file in YAML at path.
+func LoadFaultDefinition(path string) (FaultDefinition, error) {
+	var fdef FaultDefinition
+	fdefStr, err := ioutil.ReadFile(path)
+	if err != nil {
+		return fdef, err
+	}
+	if err := yaml.Unmarshal(fdefStr, &fdef); err != nil {
+		return fdef, err
+	}
+	if fdef.Namespace == "" {
+		// Pods of every namespace would be targeted otherwise
+		return fdef, errors.New("namespace of fault definition is not set")
+	}
+
+	return fdef, nil
+}
+
+type Fault struct {
+	Name string `json:"name"`
+	Target string `json:"target"`
+	Container string `json:"container"` // Container of target: agent, db or all, defaults to the one serving requests
+	Start v1.Duration `json:"start"`
+	Duration v1.Duration `json:"duration"`
+	Behaviors Behaviors `json:"behaviors"`
+}
+
+type Behaviors struct {
+	NetDelay `json:"net-delay"`
+	NetLoss `json:"net-loss"`
+	NetRate `json:"net-rate"`
+	IOStress `json:"io-stress"`
+	CPUStress `json:"cpu-stress"`
+	MemStress `json:"mem-stress"`
+	*MemLeak `json:"mem-leak"`
+	*PodKill `json:"pod-kill"`
+	*ContainerKill `json:"container-kill"`
+	*Pause `json:"pause"`
+	*Stop `json:"stop"`
+}
+
+type NetDelay struct {
+	Time v1.Duration `json:"time"`
+	Jitter v1.Duration `json:"jitter"`
+}
+
+type NetLoss struct {
+	Percent int `json:"percent"`
+}
+
+type NetRate struct {
+	Rate string `json:"rate"`
+}
+
+type IOStress struct {
+	Method string `json:"method"`
+}
+
+type CPUStress struct {
+	Load int `json:"load"`
+	Method string `json:"method"`
+}
+
+// MemStress allocates memory by stress-ng vm workers.
+type MemStress struct {
+	Workers int `json:"workers"` // Defaults to 1
+	Bytes resource.Quantity `json:"bytes"` // Memory allocated by every worker
+	Method string `json:"method"` // Defaults to all
+}
+
+// MemLeak ramps up memory allocated in steps over the fault duration.
+type MemLeak struct {
+	Bytes *resource.Quantity `json:"bytes"` // Defaults to the memory limit of target containers
+}
+
+// PodKill deletes target pods through the API.
+type PodKill struct {
+	Count int `json:"count"` // Number of pods to delete, defaults to all
+	GracePeriod *v1.Duration `json:"gracePeriod"` // Defaults to the grace period of pods
+}
+
+// ContainerKill kills target containers, which are restarted by kubelet.
+type ContainerKill struct {
+	Signal string `json:"signal"` // Defaults to SIGKILL
+}
+
+// Pause freezes processes of target containers for the fault duration.
+type Pause struct{}
+
+// Stop stops target containers gracefully for the fault duration.
+type Stop struct{}
\ No newline at end of file
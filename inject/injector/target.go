@@ -0,0 +1,103 @@
+package injector
+
+import (
+	"vecro-sim/deploy/base"
+	"vecro-sim/inject/faults"
+	"context"
+	"fmt"
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strings"
+)
+
+const labelServiceName = "vecro-sim/service-name"
+const labelServiceType = "vecro-sim/service-type"
+
+// resolveTargets returns the containers of running pods of the target service
+// of f by the node they run on. Pumba acts on the docker daemon of its own node
+// only, so one job has to be pinned on every node. Services of the same name
+// of several systems in the namespace are only told apart by the system of
+// fdef.
+func resolveTargets(ctx context.Context, clientset kubernetes.Interface, fdef FaultDefinition, f Fault) (map[string]faults.Target, error) {
+	namespace := fdef.Namespace
+	selector := fmt.Sprintf("app.kubernetes.io/managed-by=%s,%s=%s", labelManagedBy, labelServiceName, f.Target)
+	if fdef.System != "" {
+		selector += ",app.kubernetes.io/name=" + fdef.System
+	}
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: selector,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	systems := make(map[string]bool)
+	for _, pod := range pods.Items {
+		systems[pod.Labels["app.kubernetes.io/name"]] = true
+	}
+	if len(systems) > 1 {
+		names := make([]string, 0, len(systems))
+		for name := range systems {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		return nil, fmt.Errorf("target %q is a service of systems %s in namespace %q, set system to choose one", f.Target, strings.Join(names, ", "), namespace)
+	}
+
+	targets := make(map[string]faults.Target)
+	for _, pod := range pods.Items {
+		if pod.Status.Phase != apiv1.PodRunning || pod.Spec.NodeName == "" {
+			continue
+		}
+		if f.Behaviors.shapesTraffic() && hasInitContainer(pod.Spec, base.ZoneLatencyContainer) {
+			return nil, fmt.Errorf("pod %q of target %q delays traffic to other zones with a root qdisc, which net faults would replace.\nUse pause or stop faults to take it down instead", pod.Name, f.Target)
+		}
+
+		// Containers are named after the service type, as deploy names them
+		containers := base.ContainerNames(pod.Labels[labelServiceType], f.Target, f.Container)
+		if !hasContainer(pod.Spec, containers) {
+			continue
+		}
+
+		target := targets[pod.Spec.NodeName]
+		target.Containers = containers
+		target.Namespace = namespace
+		target.Pods = append(target.Pods, pod.Name)
+		targets[pod.Spec.NodeName] = target
+	}
+	if len(targets) == 0 {
+		if f.Container != base.ContainerMain {
+			return nil, fmt.Errorf("no running pod of target %q in namespace %q has %s container", f.Target, namespace, f.Container)
+		}
+		return nil, fmt.Errorf("no running pod of target %q in namespace %q", f.Target, namespace)
+	}
+	for _, target := range targets {
+		sort.Strings(target.Pods)
+	}
+
+	return targets, nil
+}
+
+func hasInitContainer(spec apiv1.PodSpec, name string) bool {
+	for _, container := range spec.InitContainers {
+		if container.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func hasContainer(spec apiv1.PodSpec, names []string) bool {
+	for _, container := range spec.Containers {
+		for _, name := range names {
+			if container.Name == name {
+				return true
+			}
+		}
+	}
+
+	return false
+}
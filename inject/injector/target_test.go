@@ -0,0 +1,94 @@
+package injector
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"vecro-sim/deploy/base"
+
+	apiv1 "k8s.io/api/core/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+)
+
+func targetPod(name string, system string, node string) *apiv1.Pod {
+	return &apiv1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      name,
+			Namespace: "shared",
+			Labels: map[string]string{
+				"app.kubernetes.io/name":       system,
+				"app.kubernetes.io/managed-by": labelManagedBy,
+				labelServiceName:               "auth",
+				labelServiceType:               "base",
+			},
+		},
+		Spec: apiv1.PodSpec{
+			NodeName:   node,
+			Containers: []apiv1.Container{{Name: "auth"}},
+		},
+		Status: apiv1.PodStatus{Phase: apiv1.PodRunning},
+	}
+}
+
+func TestResolveTargets(t *testing.T) {
+	tests := []struct {
+		name    string
+		system  string
+		want    map[string][]string
+		wantErr bool
+	}{
+		{"system a", "a", map[string][]string{"node-1": {"a-auth-1"}}, false},
+		{"system b", "b", map[string][]string{"node-1": {"b-auth-1"}, "node-2": {"b-auth-2"}}, false},
+		{"ambiguous", "", nil, true},
+		{"unknown system", "c", nil, true},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			clientset := fake.NewSimpleClientset(
+				targetPod("a-auth-1", "a", "node-1"),
+				targetPod("b-auth-1", "b", "node-1"),
+				targetPod("b-auth-2", "b", "node-2"),
+			)
+			fdef := FaultDefinition{Namespace: "shared", System: test.system}
+			targets, err := resolveTargets(context.Background(), clientset, fdef, Fault{Target: "auth", Container: base.ContainerMain})
+			if test.wantErr {
+				if err == nil {
+					t.Fatalf("got targets %v, want error", targets)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			got := make(map[string][]string)
+			for node, target := range targets {
+				got[node] = target.Pods
+			}
+			if !reflect.DeepEqual(got, test.want) {
+				t.Errorf("got pods %v, want %v", got, test.want)
+			}
+		})
+	}
+}
+
+func TestResolveTargetsRejectsNetFaultsOnZonedPods(t *testing.T) {
+	pod := targetPod("a-auth-1", "a", "node-1")
+	pod.Spec.InitContainers = []apiv1.Container{{Name: base.ZoneLatencyContainer}}
+	clientset := fake.NewSimpleClientset(pod)
+	fdef := FaultDefinition{Namespace: "shared", System: "a"}
+
+	loss := Fault{Target: "auth"}
+	loss.Behaviors.NetLoss.Percent = 10
+	if _, err := resolveTargets(context.Background(), clientset, fdef, loss); err == nil {
+		t.Error("got no error of net-loss on zoned pod")
+	}
+
+	stress := Fault{Target: "auth"}
+	stress.Behaviors.CPUStress.Load = 50
+	if _, err := resolveTargets(context.Background(), clientset, fdef, stress); err != nil {
+		t.Errorf("got error %v of cpu-stress on zoned pod", err)
+	}
+}
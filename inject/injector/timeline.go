@@ -0,0 +1,257 @@
+package injector
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"sort"
+	"strings"
+	"time"
+)
+
+// TimelineEntry is the ground truth of a fault injected into pods on one node,
+// for labelling datasets.
+type TimelineEntry struct {
+	Fault      string                 `json:"fault"`
+	Behaviors  []string               `json:"behaviors"`
+	Parameters map[string]interface{} `json:"parameters"` // Parameters by behavior
+	Target     string                 `json:"target"`
+	Container  string                 `json:"container,omitempty"`
+	Namespace  string                 `json:"namespace"`
+	Node       string                 `json:"node"`
+	Pods       []string               `json:"pods"`
+	Job        string                 `json:"job"`
+	Status     string                 `json:"status"`
+	Start      *time.Time             `json:"start"` // Unset if the fault has not started
+	End        *time.Time             `json:"end"`   // Unset if the fault has not ended
+}
+
+// active returns parameters of behaviors set, by behavior name.
+func (b Behaviors) active() map[string]interface{} {
+	behaviors := make(map[string]interface{})
+	if b.NetDelay.Time.Milliseconds() > 0 {
+		behaviors["net-delay"] = b.NetDelay
+	}
+	if b.NetLoss.Percent > 0 {
+		behaviors["net-loss"] = b.NetLoss
+	}
+	if b.NetRate.Rate != "" {
+		behaviors["net-rate"] = b.NetRate
+	}
+	if b.CPUStress.Load > 0 {
+		behaviors["cpu-stress"] = b.CPUStress
+	}
+	if b.IOStress.Method != "" {
+		behaviors["io-stress"] = b.IOStress
+	}
+	if !b.MemStress.Bytes.IsZero() {
+		behaviors["mem-stress"] = b.MemStress
+	}
+	if b.MemLeak != nil {
+		behaviors["mem-leak"] = b.MemLeak
+	}
+	if b.PodKill != nil {
+		behaviors["pod-kill"] = b.PodKill
+	}
+	if b.ContainerKill != nil {
+		behaviors["container-kill"] = b.ContainerKill
+	}
+	if b.Pause != nil {
+		behaviors["pause"] = b.Pause
+	}
+	if b.Stop != nil {
+		behaviors["stop"] = b.Stop
+	}
+
+	return behaviors
+}
+
+// injectedByJob returns whether any behavior set is injected by the pumba job
+// of the fault, which all are except for pod-kill, and mem-leak which has jobs
+// of its own.
+// shapesTraffic reports whether b runs netem on the network of targets.
+func (b Behaviors) shapesTraffic() bool {
+	behaviors := b.active()
+	for _, name := range []string{"net-delay", "net-loss", "net-rate"} {
+		if _, ok := behaviors[name]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (b Behaviors) injectedByJob() bool {
+	behaviors := b.active()
+	delete(behaviors, "pod-kill")
+	delete(behaviors, "mem-leak")
+
+	return len(behaviors) > 0
+}
+
+// Timeline returns the timeline of faults injected into fdef, with actual
+// start & end of every fault taken from status of its job & pumba pod.
+func Timeline(ctx context.Context, clientset kubernetes.Interface, fdef FaultDefinition, injected []InjectedFault) ([]TimelineEntry, error) {
+	defined := make(map[string]Fault, len(fdef.Faults))
+	for _, f := range fdef.Faults {
+		defined[f.Name] = f
+	}
+
+	entries := make([]TimelineEntry, len(injected))
+	for i, fault := range injected {
+		f := defined[fault.Fault]
+		parameters := f.Behaviors.active()
+		behaviors := make([]string, 0, len(parameters))
+		for behavior := range parameters {
+			behaviors = append(behaviors, behavior)
+		}
+		sort.Strings(behaviors)
+
+		// Windows of jobs finished are recorded before they are cleaned up
+		start, end := fault.Start, fault.End
+		if fault.Status == "" {
+			var err error
+			start, end, err = jobWindow(ctx, clientset, fdef.Namespace, fault.Job)
+			if err != nil {
+				return nil, err
+			}
+		}
+		entries[i] = TimelineEntry{
+			Fault:      f.Name,
+			Behaviors:  behaviors,
+			Parameters: parameters,
+			Target:     f.Target,
+			Container:  f.Container,
+			Namespace:  fdef.Namespace,
+			Node:       fault.Node,
+			Pods:       fault.Pods,
+			Job:        fault.Job,
+			Status:     fault.Status,
+			Start:      start,
+			End:        end,
+		}
+	}
+
+	return entries, nil
+}
+
+// jobWindow returns when pumba containers of job actually started & finished,
+// falling back to job status once its pod is gone. Times of jobs gone as well
+// are unknown.
+func jobWindow(ctx context.Context, clientset kubernetes.Interface, namespace string, job string) (*time.Time, *time.Time, error) {
+	pods, err := clientset.CoreV1().Pods(namespace).List(ctx, metav1.ListOptions{
+		LabelSelector: "job-name=" + job,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var start, end *time.Time
+	running := false
+	for _, pod := range pods.Items {
+		for _, status := range pod.Status.ContainerStatuses {
+			switch {
+			case status.State.Running != nil:
+				running = true
+				start = earliest(start, status.State.Running.StartedAt)
+			case status.State.Terminated != nil:
+				start = earliest(start, status.State.Terminated.StartedAt)
+				end = latest(end, status.State.Terminated.FinishedAt)
+			}
+		}
+	}
+	if running {
+		end = nil
+	}
+	if start != nil {
+		return start, end, nil
+	}
+
+	result, err := clientset.BatchV1().Jobs(namespace).Get(ctx, job, metav1.GetOptions{})
+	if errors.IsNotFound(err) {
+		return nil, nil, nil
+	} else if err != nil {
+		return nil, nil, err
+	}
+	if result.Status.StartTime != nil {
+		start = &result.Status.StartTime.Time
+	}
+	if result.Status.CompletionTime != nil {
+		end = &result.Status.CompletionTime.Time
+	}
+
+	return start, end, nil
+}
+
+func earliest(t *time.Time, other metav1.Time) *time.Time {
+	if other.IsZero() || (t != nil && t.Before(other.Time)) {
+		return t
+	}
+
+	return &other.Time
+}
+
+func latest(t *time.Time, other metav1.Time) *time.Time {
+	if other.IsZero() || (t != nil && t.After(other.Time)) {
+		return t
+	}
+
+	return &other.Time
+}
+
+// WriteTimelineJSON writes entries to w as a JSON array.
+func WriteTimelineJSON(w io.Writer, entries []TimelineEntry) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+
+	return encoder.Encode(entries)
+}
+
+// WriteTimelineCSV writes entries to w as CSV with a header, in which lists are
+// separated by semicolons, parameters are in JSON and times in RFC 3339.
+func WriteTimelineCSV(w io.Writer, entries []TimelineEntry) error {
+	writer := csv.NewWriter(w)
+	header := []string{"fault", "behaviors", "parameters", "target", "container", "namespace", "node", "pods", "job", "status", "start", "end"}
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		parameters, err := json.Marshal(entry.Parameters)
+		if err != nil {
+			return err
+		}
+		record := []string{
+			entry.Fault,
+			strings.Join(entry.Behaviors, ";"),
+			string(parameters),
+			entry.Target,
+			entry.Container,
+			entry.Namespace,
+			entry.Node,
+			strings.Join(entry.Pods, ";"),
+			entry.Job,
+			entry.Status,
+			formatTime(entry.Start),
+			formatTime(entry.End),
+		}
+		if err := writer.Write(record); err != nil {
+			return err
+		}
+	}
+	writer.Flush()
+
+	return writer.Error()
+}
+
+func formatTime(t *time.Time) string {
+	if t == nil {
+		return ""
+	}
+
+	return t.UTC().Format(time.RFC3339)
+}
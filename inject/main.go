@@ -1,10 +1,10 @@
 package main
 
 import (
+	"vecro-sim/inject/injector"
 	"context"
 	"flag"
-	"io/ioutil"
-	"k8s.io/apimachinery/pkg/util/yaml"
+	"io"
 	"k8s.io/client-go/kubernetes"
 	"k8s.io/client-go/tools/clientcmd"
 	"k8s.io/client-go/util/homedir"
@@ -12,6 +12,7 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 )
 
 var logger = log.New(os.Stderr, "", 0)
@@ -26,20 +27,13 @@ func main() {
 	}
 
 	defFilePath := flag.String("deffile", "", "path to fault definition file")
-	durationPtr := flag.Duration("duration", 0, "Duration of this round of fault simulation")
+	durationPtr := flag.Duration("duration", 0, "(optional) maximum duration of this round of fault simulation, cancelling faults still running")
+	timelinePath := flag.String("timeline", "", "path to write timeline of injected faults to, in both JSON (.json) and CSV (.csv)")
 
 	flag.Parse()
 
 	// Open & parse fault definition file in YAML
-	defFile, err := os.Open(*defFilePath)
-	if err != nil {
-		panic(err)
-	}
-	defer defFile.Close()
-
-	fdefStr, _ := ioutil.ReadAll(defFile)
-	var fdef FaultDefinition
-	err = yaml.Unmarshal(fdefStr, &fdef)
+	fdef, err := injector.LoadFaultDefinition(*defFilePath)
 	if err != nil {
 		panic(err)
 	}
@@ -49,14 +43,72 @@ func main() {
 
 	// Make Ctrl-C interruptible
 	ctx := interruptibleCxt()
-	// Cancel requests when duration expired
+	horizon := fdef.Horizon()
+	logger.Printf("Faults of %q are scheduled to end in %s.", fdef.Name, horizon)
+	// Cancel faults when duration expired
 	if *durationPtr != 0 {
+		if *durationPtr < horizon {
+			logger.Printf("Faults running after %s will be cancelled.", *durationPtr)
+		}
 		var cancel context.CancelFunc
 		ctx, cancel = context.WithTimeout(ctx, *durationPtr)
 		defer cancel()
 	}
 
-	fdef.Run(ctx, clientset)
+	// Every fault runs to its end, unless cancelled
+	result, injectErr := injector.InjectFaults(ctx, clientset, fdef)
+	if *timelinePath != "" {
+		writeTimeline(clientset, fdef, result, *timelinePath)
+	}
+	if injectErr != nil {
+		logger.Print(injectErr)
+	}
+
+	if !summarize(fdef, result) {
+		os.Exit(1)
+	}
+	logger.Print("Fault injection completed successfully.")
+}
+
+// summarize prints the status of every fault, and returns whether all of them
+// succeeded.
+func summarize(fdef injector.FaultDefinition, result *injector.InjectResult) bool {
+	succeeded := true
+	logger.Printf("Faults of %q:", fdef.Name)
+	for _, f := range fdef.Faults {
+		status := result.Statuses[f.Name]
+		logger.Printf("- %s: %s", f.Name, status)
+		succeeded = succeeded && status == injector.JobSucceeded
+	}
+
+	return succeeded
+}
+
+// writeTimeline writes the timeline of faults injected to path in both JSON
+// and CSV, replacing the extension of path if any.
+func writeTimeline(clientset kubernetes.Interface, fdef injector.FaultDefinition, result *injector.InjectResult, path string) {
+	entries, err := injector.Timeline(context.TODO(), clientset, fdef, result.Injected)
+	if err != nil {
+		logger.Fatal(err)
+	}
+
+	path = strings.TrimSuffix(path, filepath.Ext(path))
+	for ext, write := range map[string]func(io.Writer, []injector.TimelineEntry) error{
+		".json": injector.WriteTimelineJSON,
+		".csv":  injector.WriteTimelineCSV,
+	} {
+		file, err := os.Create(path + ext)
+		if err != nil {
+			logger.Fatal(err)
+		}
+		if err := write(file, entries); err != nil {
+			logger.Fatal(err)
+		}
+		if err := file.Close(); err != nil {
+			logger.Fatal(err)
+		}
+		logger.Printf("Wrote timeline of %d faults to %q.", len(entries), path+ext)
+	}
 }
 
 func getClientset(kubeconfig string) *kubernetes.Clientset {
@@ -0,0 +1,146 @@
+package generator
+
+import (
+	"bytes"
+	"context"
+	"crypto/tls"
+	"errors"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"os"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+var tr http.RoundTripper = &http.Transport{
+	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
+	DisableKeepAlives: true,
+}
+var client = &http.Client{
+	Transport: tr,
+	Timeout:   15 * time.Second,
+}
+var logger = log.New(os.Stderr, "", 0)
+
+// Errors returned by RunLoad for invalid options.
+var (
+	ErrNoURL   = errors.New("no URL given")
+	ErrNoUsers = errors.New("number of users must be positive")
+	ErrNoDelay = errors.New("delay between calls must be positive")
+)
+
+// LoadOptions configures the load generated by RunLoad.
+type LoadOptions struct {
+	URLs  []string      // URLs to perform requests on
+	Body  []byte        // Request body
+	Users int           // Number of concurrent users per URL
+	Delay time.Duration // Delay between calls per user
+}
+
+// LoadResult counts requests performed by RunLoad. Responses with an error
+// status are failed.
+type LoadResult struct {
+	Requests  int64
+	Succeeded int64
+	TimedOut  int64
+	Failed    int64
+}
+
+// RunLoad simulates users requesting every URL repeatedly until ctx is done.
+func RunLoad(ctx context.Context, opts LoadOptions) (*LoadResult, error) {
+	if len(opts.URLs) == 0 {
+		return nil, ErrNoURL
+	}
+	if opts.Users <= 0 {
+		return nil, ErrNoUsers
+	}
+	if opts.Delay <= 0 {
+		return nil, ErrNoDelay
+	}
+
+	result := &LoadResult{}
+	var wg sync.WaitGroup
+	for _, url := range opts.URLs {
+		for i := 0; i < opts.Users; i++ {
+			// TODO: configurable request methods
+			wg.Add(1)
+			go func(url string, id int) {
+				defer wg.Done()
+				singleUser(ctx, result, "POST", opts.Body, url, opts.Delay, id)
+			}(url, i)
+		}
+
+		// Sleep a little while to avoid congestion
+		select {
+		case <-time.After(time.Duration(int(opts.Delay) / (len(url) + 1))):
+		case <-ctx.Done():
+		}
+	}
+	wg.Wait()
+
+	return result, nil
+}
+
+func singleUser(ctx context.Context, result *LoadResult, method string, body []byte, url string, delay time.Duration, id int) {
+	// Perform one request immediately
+	performRequest(ctx, result, method, body, url, id)
+
+	// Perform requests after specified delay afterwards
+	t := time.NewTicker(delay)
+	defer t.Stop()
+	for {
+		select {
+		case <-t.C:
+			performRequest(ctx, result, method, body, url, id)
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+func performRequest(ctx context.Context, result *LoadResult, method string, body []byte, url string, id int) {
+	// Build request with context
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(body))
+	if err != nil {
+		logger.Printf("[%d] %v", id, err)
+		atomic.AddInt64(&result.Failed, 1)
+		return
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Request has been cancelled
+			logger.Printf("[%d] Cancelled", id)
+			return
+		}
+
+		atomic.AddInt64(&result.Requests, 1)
+		if os.IsTimeout(err) {
+			// Request timed out
+			logger.Printf("[%d] Timeout", id)
+			atomic.AddInt64(&result.TimedOut, 1)
+		} else {
+			logger.Printf("[%d] %v", id, err)
+			atomic.AddInt64(&result.Failed, 1)
+		}
+	} else {
+		defer resp.Body.Close()
+		atomic.AddInt64(&result.Requests, 1)
+		body, err := ioutil.ReadAll(resp.Body)
+		if err != nil {
+			logger.Printf("[%d] %v", id, err)
+			atomic.AddInt64(&result.Failed, 1)
+			return
+		}
+		if resp.StatusCode >= http.StatusBadRequest {
+			logger.Printf("[%d] %s", id, resp.Status)
+			atomic.AddInt64(&result.Failed, 1)
+			return
+		}
+		atomic.AddInt64(&result.Succeeded, 1)
+		logger.Printf("[%d]: %s", id, string(body))
+	}
+}
@@ -0,0 +1,60 @@
+package generator
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRunLoadOptions(t *testing.T) {
+	tests := []struct {
+		name string
+		opts LoadOptions
+		err  error
+	}{
+		{"no url", LoadOptions{Users: 1, Delay: time.Second}, ErrNoURL},
+		{"no users", LoadOptions{URLs: []string{"http://127.0.0.1"}, Delay: time.Second}, ErrNoUsers},
+		{"no delay", LoadOptions{URLs: []string{"http://127.0.0.1"}, Users: 1}, ErrNoDelay},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if _, err := RunLoad(context.Background(), test.opts); err != test.err {
+				t.Errorf("got error %v, want %v", err, test.err)
+			}
+		})
+	}
+}
+
+func TestRunLoadStatus(t *testing.T) {
+	tests := []struct {
+		status    int
+		succeeded bool
+	}{
+		{http.StatusOK, true},
+		{http.StatusNotFound, false},
+		{http.StatusInternalServerError, false},
+	}
+	for _, test := range tests {
+		t.Run(http.StatusText(test.status), func(t *testing.T) {
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.WriteHeader(test.status)
+			}))
+			defer server.Close()
+
+			ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+			defer cancel()
+			result, err := RunLoad(ctx, LoadOptions{URLs: []string{server.URL}, Users: 1, Delay: time.Hour})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if result.Requests != 1 {
+				t.Fatalf("got %d requests, want 1", result.Requests)
+			}
+			if succeeded := result.Succeeded == 1; succeeded != test.succeeded {
+				t.Errorf("got %d succeeded & %d failed, want succeeded %v", result.Succeeded, result.Failed, test.succeeded)
+			}
+		})
+	}
+}
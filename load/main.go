@@ -1,25 +1,17 @@
 package main
 
 import (
+	"vecro-sim/load/generator"
 	"context"
-	"crypto/tls"
+	"errors"
 	"flag"
 	"log"
-	"net/http"
 	"os"
 	"os/signal"
 	"strings"
 	"time"
 )
 
-var tr http.RoundTripper = &http.Transport{
-	TLSClientConfig:   &tls.Config{InsecureSkipVerify: true},
-	DisableKeepAlives: true,
-}
-var client = &http.Client{
-	Transport: tr,
-	Timeout: 15 * time.Second,
-}
 var logger = log.New(os.Stderr, "", 0)
 
 const urlSeparator  = " "
@@ -42,7 +34,20 @@ func main() {
 		defer cancel()
 	}
 
-	Simulate(ctx, parseURLList(urlListPtr), []byte(*bodyPtr), *usersPtr, *delayPtr)
+	result, err := generator.RunLoad(ctx, generator.LoadOptions{
+		URLs:  parseURLList(urlListPtr),
+		Body:  []byte(*bodyPtr),
+		Users: *usersPtr,
+		Delay: *delayPtr,
+	})
+	if err != nil {
+		logger.Fatal(err)
+	}
+	if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+		logger.Print("Load simulation completed successfully.")
+	}
+	logger.Printf("%d requests performed: %d succeeded, %d timed out, %d failed.",
+		result.Requests, result.Succeeded, result.TimedOut, result.Failed)
 }
 
 func parseURLList(str *string) []string {